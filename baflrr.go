@@ -0,0 +1,132 @@
+package beadarray
+
+import (
+	"fmt"
+	"math"
+)
+
+// BAlleleFreqLogRRatio returns the B allele frequency and log R ratio of a
+// locus with normalized intensities r and theta, given the cluster
+// positions in c. It follows the GenomeStudio rules:
+//
+// BAF is 0 at or below the AA cluster theta, 0.5 at the AB cluster, 1 at or
+// above the BB cluster and linearly interpolated in between. A cluster with
+// no samples (N == 0) is placed at theta 0 for AA, theta 1 for BB and
+// midway between AA and BB for AB.
+//
+// LRR is log2(r / rExpected), where rExpected is the R of the populated
+// clusters interpolated linearly in theta, and the R of the nearest
+// populated cluster outside them.
+//
+// Both values are NaN if r or theta is NaN, and LRR is NaN if no cluster is
+// populated.
+func BAlleleFreqLogRRatio(r, theta float32, c ClusterRecord) (float32, float32) {
+	nan := float32(math.NaN())
+	if isNaN(r) || isNaN(theta) {
+		return nan, nan
+	}
+	return bAlleleFreq(theta, c), logRRatio(r, theta, c)
+}
+
+func bAlleleFreq(theta float32, c ClusterRecord) float32 {
+	aa, ab, bb := c.AAClusterStats.ThetaMean, c.ABClusterStats.ThetaMean, c.BBClusterStats.ThetaMean
+	if c.AAClusterStats.N == 0 {
+		aa = 0
+	}
+	if c.BBClusterStats.N == 0 {
+		bb = 1
+	}
+	if c.ABClusterStats.N == 0 {
+		ab = (aa + bb) / 2
+	}
+	switch {
+	case theta <= aa:
+		return 0
+	case theta >= bb:
+		return 1
+	case theta < ab:
+		return 0.5 * (theta - aa) / (ab - aa)
+	case theta > ab:
+		return 0.5 + 0.5*(theta-ab)/(bb-ab)
+	default:
+		return 0.5
+	}
+}
+
+func logRRatio(r, theta float32, c ClusterRecord) float32 {
+	var clusters []ClusterStats
+	for _, s := range []ClusterStats{c.AAClusterStats, c.ABClusterStats, c.BBClusterStats} {
+		if s.N > 0 {
+			clusters = append(clusters, s)
+		}
+	}
+	if len(clusters) == 0 {
+		return float32(math.NaN())
+	}
+	expected := clusters[0].RMean
+	if theta >= clusters[len(clusters)-1].ThetaMean {
+		expected = clusters[len(clusters)-1].RMean
+	} else {
+		for i := 1; i < len(clusters); i++ {
+			lo, hi := clusters[i-1], clusters[i]
+			if theta < hi.ThetaMean {
+				if theta > lo.ThetaMean {
+					expected = lo.RMean + (theta-lo.ThetaMean)*(hi.RMean-lo.RMean)/(hi.ThetaMean-lo.ThetaMean)
+				} else {
+					expected = lo.RMean
+				}
+				break
+			}
+		}
+	}
+	return float32(math.Log2(float64(r / expected)))
+}
+
+func isNaN(x float32) bool {
+	return x != x
+}
+
+// ClusterRecordsFor returns the cluster record of each locus in names, in
+// the same order. It returns an error if a locus has no cluster record.
+func (e *EGT) ClusterRecordsFor(names []string) ([]ClusterRecord, error) {
+	records := make([]ClusterRecord, len(names))
+	for i, name := range names {
+		record, ok := e.findRecord(name)
+		if !ok {
+			return nil, fmt.Errorf("cluster file has no record for locus %s", name)
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// BAlleleFreqsLogRRatios computes the B allele frequency and log R ratio of
+// every locus from normalized R and Theta and the matching cluster
+// records.
+func BAlleleFreqsLogRRatios(rs, thetas []float32, records []ClusterRecord) ([]float32, []float32, error) {
+	if len(rs) != len(thetas) || len(rs) != len(records) {
+		return nil, nil, fmt.Errorf("have %d R, %d Theta values and %d cluster records", len(rs), len(thetas), len(records))
+	}
+	bafs := make([]float32, len(rs))
+	lrrs := make([]float32, len(rs))
+	for i := range rs {
+		bafs[i], lrrs[i] = BAlleleFreqLogRRatio(rs[i], thetas[i], records[i])
+	}
+	return bafs, lrrs, nil
+}
+
+// ComputeBAlleleFreqsLogRRatios computes the B allele frequency and log R
+// ratio of every SNP in g from its intensities, normalized with b, and the
+// clusters in e. Unlike BAlleleFreqs and LogRRatios it works for every GTC
+// version and with any cluster file for the manifest.
+func (g GTC) ComputeBAlleleFreqsLogRRatios(b BPM, e *EGT) ([]float32, []float32, error) {
+	records, err := e.ClusterRecordsFor(b.Names)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, thetas, err := g.PolarIntensities(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return BAlleleFreqsLogRRatios(rs, thetas, records)
+}
@@ -0,0 +1,97 @@
+package beadarray
+
+import (
+	"math"
+	"testing"
+)
+
+func testClusterRecord(aaN, abN, bbN int) ClusterRecord {
+	return ClusterRecord{
+		AAClusterStats: ClusterStats{ThetaMean: 0.1, ThetaDev: 0.02, RMean: 1.0, RDev: 0.1, N: aaN},
+		ABClusterStats: ClusterStats{ThetaMean: 0.5, ThetaDev: 0.04, RMean: 2.0, RDev: 0.2, N: abN},
+		BBClusterStats: ClusterStats{ThetaMean: 0.9, ThetaDev: 0.02, RMean: 1.0, RDev: 0.1, N: bbN},
+	}
+}
+
+func TestBAlleleFreqLogRRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		r, theta float32
+		record   ClusterRecord
+		baf, lrr float64
+	}{
+		{"on AA", 1, 0.1, testClusterRecord(10, 10, 10), 0, 0},
+		{"below AA", 2, 0.05, testClusterRecord(10, 10, 10), 0, 1},
+		{"on AB", 2, 0.5, testClusterRecord(10, 10, 10), 0.5, 0},
+		{"between AA and AB", 1.5, 0.3, testClusterRecord(10, 10, 10), 0.25, 0},
+		{"between AB and BB", 3, 0.7, testClusterRecord(10, 10, 10), 0.75, 1},
+		{"above BB", 0.5, 0.95, testClusterRecord(10, 10, 10), 1, -1},
+		{"missing AB", 1, 0.5, testClusterRecord(10, 0, 10), 0.5, 0},
+		{"missing AA", 2, 0.25, testClusterRecord(0, 10, 10), 0.25, 0},
+		{"only BB", 2, 0.225, testClusterRecord(0, 0, 10), 0.25, 1},
+	}
+	for _, tt := range tests {
+		baf, lrr := BAlleleFreqLogRRatio(tt.r, tt.theta, tt.record)
+		if math.Abs(float64(baf)-tt.baf) > 1e-6 || math.Abs(float64(lrr)-tt.lrr) > 1e-6 {
+			t.Errorf("%s: BAlleleFreqLogRRatio() = %v, %v; want %v, %v", tt.name, baf, lrr, tt.baf, tt.lrr)
+		}
+	}
+
+	nan := float32(math.NaN())
+	if baf, lrr := BAlleleFreqLogRRatio(nan, nan, testClusterRecord(10, 10, 10)); !isNaN(baf) || !isNaN(lrr) {
+		t.Errorf("BAlleleFreqLogRRatio(NaN, NaN) = %v, %v; want NaN", baf, lrr)
+	}
+	if _, lrr := BAlleleFreqLogRRatio(1, 0.5, testClusterRecord(0, 0, 0)); !isNaN(lrr) {
+		t.Errorf("BAlleleFreqLogRRatio() with no clusters: LRR = %v, want NaN", lrr)
+	}
+}
+
+func TestComputeBAlleleFreqsLogRRatios(t *testing.T) {
+	d := testGTCData(3, 10)
+	b := testBPM(10)
+	e := &EGT{Name2ClusterRecord: make(map[string]ClusterRecord)}
+	for _, name := range b.Names {
+		e.Name2ClusterRecord[name] = testClusterRecord(10, 10, 10)
+	}
+	bafs, lrrs, err := testGTC(t, d).ComputeBAlleleFreqsLogRRatios(b, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bafs) != 10 || len(lrrs) != 10 {
+		t.Fatalf("got %d BAFs and %d LRRs, want 10", len(bafs), len(lrrs))
+	}
+	for i := range bafs {
+		if bafs[i] < 0 || bafs[i] > 1 {
+			t.Errorf("SNP %d: BAF = %v, want between 0 and 1", i, bafs[i])
+		}
+	}
+
+	delete(e.Name2ClusterRecord, b.Names[4])
+	if _, _, err := testGTC(t, d).ComputeBAlleleFreqsLogRRatios(b, e); err == nil {
+		t.Errorf("ComputeBAlleleFreqsLogRRatios() with missing cluster record succeeded, want error")
+	}
+}
+
+func TestClusterRecordsForWithoutMap(t *testing.T) {
+	b := testBPM(3)
+	var records []ClusterRecord
+	for _, name := range []string{"rs3", "rs1", "rs2"} {
+		c := testClusterRecord(10, 10, 10)
+		c.Name = name
+		records = append(records, c)
+	}
+	// Records held only in ClusterRecords, without Name2ClusterRecord.
+	e := &EGT{ClusterRecords: records}
+	got, err := e.ClusterRecordsFor(b.Names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range b.Names {
+		if got[i].Name != name {
+			t.Errorf("record %d = %s, want %s", i, got[i].Name, name)
+		}
+	}
+	if _, err := e.ClusterRecordsFor([]string{"rs4"}); err == nil {
+		t.Errorf("ClusterRecordsFor() of missing locus succeeded")
+	}
+}
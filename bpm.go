@@ -5,22 +5,37 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 )
 
 // BPM ...
 type BPM struct {
+	// Version is the manifest version, without the 0x1000 flag bit. The
+	// flag is recorded in VersionFlag.
 	Version          int
+	VersionFlag      bool
 	ManifestName     string
 	Names            []string
 	NumLoci          int
 	ControlConfig    string
 	NormalizationIDs []byte
-	LocusEntries     map[string]LocusEntry
+	// Loci holds the locus entries in the order of Names, which is the
+	// order of the per-SNP arrays in a GTC. LocusEntries holds the same
+	// entries keyed by name; if names are duplicated it holds the first.
+	// Use SetLoci to change them so that both, and the lookup indexes, stay
+	// consistent.
+	Loci         []LocusEntry
+	LocusEntries map[string]LocusEntry
+
+	name2index    map[string]int
+	address2index map[int]int
 }
 
 // LocusEntry ...
 type LocusEntry struct {
+	// Index is the locus' entry in the index array of the manifest.
+	Index         int
 	LocusVersion  int
 	IlmnID        string
 	Name          string
@@ -51,161 +66,271 @@ type LocusEntry struct {
 //}
 
 // NewBPM ...
-func NewBPM(path string) (ret BPM, err error) {
-	ret = BPM{}
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
-		}
-	}()
-
+func NewBPM(path string) (BPM, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return ret, err
+		return BPM{}, err
 	}
 	defer f.Close()
+	return NewBPMFromReader(bufio.NewReaderSize(f, 4096))
+}
 
-	file := bufio.NewReaderSize(f, 4096)
+// bpmVersionFlag is set in the version of most manifests.
+const bpmVersionFlag = 0x1000
 
-	formatName, err := readNextBytes(file, 3)
-	if err != nil {
-		return ret, err
-	}
-
-	if string(formatName) != "BPM" {
-		return ret, fmt.Errorf("file is not BPM format")
-	}
+// NewBPMFromReader reads a BPM manifest from r.
+func NewBPMFromReader(r io.Reader) (BPM, error) {
+	d := newDecoder(r, "BPM")
 
-	_, err = readNextBytes(file, 1)
-	if err != nil {
-		return ret, err
+	formatName := d.readBytes("Identifier", 3)
+	if d.err == nil && string(formatName) != "BPM" {
+		return BPM{}, d.errorf("Identifier", "file is not BPM format")
 	}
 
-	version := mustReadInt(file)
-	versionFlag := 0x1000
+	d.readBytes("FormatVersion", 1)
 
-	if (version & versionFlag) == versionFlag {
-		version = (version ^ version)
+	version := d.readInt("Version")
+	versionFlag := version&bpmVersionFlag == bpmVersionFlag
+	if versionFlag {
+		version ^= bpmVersionFlag
 	}
-	manifestName := mustReadString(file)
+	manifestName := d.readString("ManifestName")
 	var controlConfig string = ""
 	if version > 1 {
-		controlConfig = mustReadString(file)
+		controlConfig = d.readString("ControlConfig")
 	}
-	numLoci := mustReadInt(file)
-	// readNextBytes(file, 4*numLoci)
-	for i := 0; i < numLoci; i++ {
-		_, err := readInt(file)
-		if err != nil {
-			return ret, err
-		}
+	numLoci := d.readInt("NumLoci")
+	if d.err == nil && numLoci < 0 {
+		return BPM{}, d.errorf("NumLoci", "invalid number of loci %d", numLoci)
+	}
+	d.setLocus(-1, "")
+	indexes := d.readInt32s("Indexes", numLoci)
+	// Having read numLoci indexes the count is known to be backed by data
+	// in the file, so it is safe to use for the allocations below.
+	if d.err != nil {
+		return BPM{}, d.err
 	}
 	names := make([]string, numLoci)
 	for i := 0; i < numLoci; i++ {
-		names[i] = mustReadString(file)
+		d.setLocus(i, "")
+		names[i] = d.readString("Name")
 	}
 	normalizationIds := make([]byte, numLoci)
 	for i := 0; i < numLoci; i++ {
-		id := mustReadByte(file)
-		if id >= 100 {
-			return ret, fmt.Errorf("Manifest format error: read invalid normalization ID")
+		d.setLocus(i, names[i])
+		id := d.readByte("NormalizationID")
+		if d.err == nil && id >= 100 {
+			return BPM{}, d.errorf("NormalizationID", "Manifest format error: read invalid normalization ID")
 		}
 		normalizationIds[i] = id
 	}
-	locusEntries := make(map[string]LocusEntry)
+
+	// Locus entries need not be in the order of names. Each is placed at
+	// the first unfilled position with its name.
+	positions := make(map[string][]int, numLoci)
+	for i := numLoci - 1; i >= 0; i-- {
+		positions[names[i]] = append(positions[names[i]], i)
+	}
+	loci := make([]LocusEntry, numLoci)
 	for i := 0; i < numLoci; i++ {
-		locus, err := NewLocusEntry(file)
-		if err != nil {
-			return ret, err
+		d.setLocus(i, "")
+		locus := readLocusEntry(d)
+		if d.err != nil {
+			return BPM{}, d.err
 		}
-		locusEntries[locus.Name] = locus
+		p := positions[locus.Name]
+		if len(p) == 0 {
+			return BPM{}, d.errorf("Name", "locus entry %s does not match a name in the manifest", locus.Name)
+		}
+		j := p[len(p)-1]
+		positions[locus.Name] = p[:len(p)-1]
+		locus.Index = int(indexes[j])
+		loci[j] = locus
 	}
-	return BPM{
+	b := BPM{
 		Version:          version,
+		VersionFlag:      versionFlag,
 		ManifestName:     manifestName,
-		Names:            names,
-		NumLoci:          numLoci,
 		ControlConfig:    controlConfig,
 		NormalizationIDs: normalizationIds,
-		LocusEntries:     locusEntries,
-	}, nil
+	}
+	b.SetLoci(loci)
+	return b, nil
+}
+
+// SetLoci replaces the loci of b with loci and rebuilds Names, NumLoci,
+// LocusEntries and the lookup indexes from them.
+func (b *BPM) SetLoci(loci []LocusEntry) {
+	b.Loci = loci
+	b.NumLoci = len(loci)
+	b.Names = make([]string, len(loci))
+	b.LocusEntries = make(map[string]LocusEntry, len(loci))
+	b.name2index = make(map[string]int, len(loci))
+	b.address2index = make(map[int]int, len(loci))
+	for i := len(loci) - 1; i >= 0; i-- {
+		locus := loci[i]
+		b.Names[i] = locus.Name
+		b.LocusEntries[locus.Name] = locus
+		b.name2index[locus.Name] = i
+		// An address of 0 means the locus has no such probe.
+		if locus.AddressB != 0 {
+			b.address2index[locus.AddressB] = i
+		}
+		if locus.AddressA != 0 {
+			b.address2index[locus.AddressA] = i
+		}
+	}
+}
+
+// LocusByIndex returns the i'th locus, the locus of the i'th entry in the
+// per-SNP arrays of a GTC.
+func (b BPM) LocusByIndex(i int) (LocusEntry, bool) {
+	if i < 0 || i >= len(b.Names) {
+		return LocusEntry{}, false
+	}
+	if len(b.Loci) == len(b.Names) {
+		return b.Loci[i], true
+	}
+	locus, ok := b.LocusEntries[b.Names[i]]
+	return locus, ok
+}
+
+// LocusIndex returns the index of the first locus with the given name.
+func (b BPM) LocusIndex(name string) (int, bool) {
+	if b.name2index != nil {
+		i, ok := b.name2index[name]
+		return i, ok
+	}
+	for i, n := range b.Names {
+		if n == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// LocusByName returns the first locus with the given name.
+func (b BPM) LocusByName(name string) (LocusEntry, bool) {
+	i, ok := b.LocusIndex(name)
+	if !ok {
+		return LocusEntry{}, false
+	}
+	return b.LocusByIndex(i)
+}
+
+// LocusByAddress returns the first locus with the given bead address as
+// either its AddressA or its AddressB. No locus has address 0.
+func (b BPM) LocusByAddress(address int) (LocusEntry, bool) {
+	if address == 0 {
+		return LocusEntry{}, false
+	}
+	if b.address2index != nil {
+		i, ok := b.address2index[address]
+		if !ok {
+			return LocusEntry{}, false
+		}
+		return b.LocusByIndex(i)
+	}
+	for i := range b.Names {
+		locus, ok := b.LocusByIndex(i)
+		if ok && (locus.AddressA == address || locus.AddressB == address) {
+			return locus, true
+		}
+	}
+	return LocusEntry{}, false
 }
 
 // NewLocusEntry ...
 func NewLocusEntry(file io.Reader) (LocusEntry, error) {
+	d := newDecoder(file, "BPM")
+	locus := readLocusEntry(d)
+	return locus, d.err
+}
+
+// readLocusEntry reads a single locus entry. Errors are recorded in d.
+//
+// Versions 6, 7 and 8 follow BeadArrayFiles: version 7 adds 16 unknown bytes
+// to the version 6 layout and version 8 then adds RefStrand. The version 4
+// layout is not documented, so version 4 entries are rejected.
+func readLocusEntry(d *decoder) LocusEntry {
 	ret := LocusEntry{}
 	// Read Locus Entry
-	locusVersion := mustReadInt(file)
+	locusVersion := d.readInt("LocusVersion")
+	if d.err != nil {
+		return ret
+	}
 	switch locusVersion {
-	case 6:
-		return ret, fmt.Errorf("can not parse locus entry version 6")
-	case 7:
-		return ret, fmt.Errorf("can not parse locus entry version 7")
-	case 8:
+	case 6, 7, 8:
+	case 4:
+		d.errorf("LocusVersion", "Manifest format error: locus entry version 4 is not supported")
+		return ret
 	default:
-		return ret, fmt.Errorf("Manifest format error: unknown version for locus entry (%v)", locusVersion)
+		d.errorf("LocusVersion", "Manifest format error: unknown version for locus entry (%v)", locusVersion)
+		return ret
 	}
-	ilmnID := mustReadString(file)
-	name := mustReadString(file)
+	// Strings of unknown meaning. Version 8 entries always leave them empty,
+	// so anything else is treated as a format error; in older versions they
+	// are skipped.
+	unknown := func(label string) {
+		s := d.readString("Unknown")
+		if d.err == nil && locusVersion == 8 && s != "" {
+			d.errorf("Unknown", "%s expected empty string, got %s", label, s)
+		}
+	}
+
+	ilmnID := d.readString("IlmnID")
+	name := d.readString("Name")
+	d.setLocus(d.locus, name)
 
 	for j := 0; j < 3; j++ {
-		s := mustReadString(file)
-		if s != "" {
-			return ret, fmt.Errorf("a expected empty string, got %s", s)
-		}
+		unknown("a")
 	}
 	// This is a counter from numLoci down...
-	_ = mustReadInt(file)
-
-	s := mustReadString(file)
-	if s != "" {
-		return ret, fmt.Errorf("b expected empty string, got %s", s)
-	}
-	ilmnStrand := mustReadString(file)
-	snp := mustReadString(file)
-	chrom := mustReadString(file)
-	ploidy := mustReadString(file)
-	species := mustReadString(file)
-	s = mustReadString(file)
+	_ = d.readInt("Index")
+
+	unknown("b")
+	ilmnStrand := d.readString("IlmnStrand")
+	snp := d.readString("SNP")
+	chrom := d.readString("Chrom")
+	ploidy := d.readString("Ploidy")
+	species := d.readString("Species")
+	s := d.readString("MapInfo")
+	if d.err != nil {
+		return ret
+	}
 	mapInfo, err := strconv.Atoi(s)
 	if err != nil {
-		return ret, err
-	}
-	s = mustReadString(file)
-	if s != "" {
-		return ret, fmt.Errorf("c expected empty string, got %s", s)
+		d.fail("MapInfo", d.last, err)
+		return ret
 	}
-	sourceStrand := mustReadString(file)
-	addressA := mustReadInt(file)
-	addressB := mustReadInt(file)
+	unknown("c")
+	sourceStrand := d.readString("SourceStrand")
+	addressA := d.readInt("AddressA")
+	addressB := d.readInt("AddressB")
 
 	for i := 0; i < 2; i++ {
-		s := mustReadString(file)
-		if s != "" {
-			return ret, fmt.Errorf("d expected empty string, got %s", s)
-		}
+		unknown("d")
 	}
-	genomeBuild := mustReadString(file)
-	source := mustReadString(file)
-	sourceVersion := mustReadString(file)
+	genomeBuild := d.readString("GenomeBuild")
+	source := d.readString("Source")
+	sourceVersion := d.readString("SourceVersion")
 	// This appears to be sourceStrand again !?
-	_ = mustReadString(file)
-	s = mustReadString(file)
-	if s != "" {
-		return ret, fmt.Errorf("e expected empty string, got %s", s)
-	}
+	_ = d.readString("SourceStrand")
+	unknown("e")
 
-	_, err = readNextBytes(file, 3)
-	if err != nil {
-		return ret, nil
-	}
-	assayType := mustReadByte(file)
+	d.readBytes("Unknown", 3)
+	assayType := d.readByte("AssayType")
 
-	_, err = readNextBytes(file, 4*4)
-	if err != nil {
-		return ret, err
+	var refStrand string
+	if locusVersion >= 7 {
+		d.readBytes("Unknown", 4*4)
+	}
+	if locusVersion >= 8 {
+		refStrand = d.readString("RefStrand")
+	}
+	if d.err != nil {
+		return ret
 	}
-	refStrand := mustReadString(file)
 
 	return LocusEntry{
 		LocusVersion:  locusVersion,
@@ -225,7 +350,7 @@ func NewLocusEntry(file io.Reader) (LocusEntry, error) {
 		Ploidy:        ploidy,
 		Species:       species,
 		IlmnStrand:    ilmnStrand,
-	}, nil
+	}
 }
 
 // func parseLocusVersion6(f io.Reader) (LocusEntry, error) {
@@ -236,3 +361,48 @@ func NewLocusEntry(file io.Reader) (LocusEntry, error) {
 
 // func parseLocusVersion8(f io.Reader) (LocusEntry, error) {
 // }
+
+// NormalizationLookups returns, for each locus in Names order, the index of
+// its normalization transform in a GTC, as expected by
+// GTC.NormalizedIntensities. Following BeadArrayFiles, a locus'
+// normalization ID is offset by 100 times its assay type and transforms are
+// ordered by the sorted set of distinct IDs.
+func (b BPM) NormalizationLookups() ([]byte, error) {
+	lookups, _, err := b.normalizationLookups()
+	return lookups, err
+}
+
+// normalizationLookups returns the lookups and the number of distinct
+// normalization IDs, which is the number of transforms a GTC must have.
+func (b BPM) normalizationLookups() ([]byte, int, error) {
+	if len(b.NormalizationIDs) != len(b.Names) {
+		return nil, 0, fmt.Errorf("manifest has %d names but %d normalization IDs", len(b.Names), len(b.NormalizationIDs))
+	}
+	ids := make([]int, len(b.Names))
+	distinct := make(map[int]bool)
+	for i, name := range b.Names {
+		locus, ok := b.LocusByIndex(i)
+		if !ok {
+			return nil, 0, fmt.Errorf("no locus entry for %s", name)
+		}
+		ids[i] = int(b.NormalizationIDs[i]) + 100*int(locus.AssayType)
+		distinct[ids[i]] = true
+	}
+	sorted := make([]int, 0, len(distinct))
+	for id := range distinct {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+	if len(sorted) > 256 {
+		return nil, 0, fmt.Errorf("manifest has %d normalization IDs, at most 256 are supported", len(sorted))
+	}
+	index := make(map[int]byte, len(sorted))
+	for i, id := range sorted {
+		index[id] = byte(i)
+	}
+	lookups := make([]byte, len(ids))
+	for i, id := range ids {
+		lookups[i] = index[id]
+	}
+	return lookups, len(sorted), nil
+}
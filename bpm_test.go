@@ -0,0 +1,181 @@
+package beadarray
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestNormalizationLookups(t *testing.T) {
+	b := testBPM(6)
+	b.NormalizationIDs = []byte{7, 3, 7, 3, 7, 3}
+	// An Infinium I assay with the same normalization ID uses a separate
+	// transform.
+	b.Loci[4].AssayType = 1
+	b.SetLoci(b.Loci)
+
+	got, err := b.NormalizationLookups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{1, 0, 1, 0, 2, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizationLookups() = %v, want %v", got, want)
+	}
+}
+
+// encodeLocusEntry encodes l in the layout of locus entry version
+// l.LocusVersion, filling the unknown strings with unknown.
+func encodeLocusEntry(l LocusEntry, unknown string) []byte {
+	var buf bytes.Buffer
+	writeInt(&buf, l.LocusVersion)
+	writeString(&buf, l.IlmnID)
+	writeString(&buf, l.Name)
+	for i := 0; i < 3; i++ {
+		writeString(&buf, unknown)
+	}
+	writeInt(&buf, 1)
+	writeString(&buf, unknown)
+	for _, s := range []string{l.IlmnStrand, l.SNP, l.Chrom, l.Ploidy, l.Species, strconv.Itoa(l.MapInfo), unknown, l.SourceStrand} {
+		writeString(&buf, s)
+	}
+	writeInt(&buf, l.AddressA)
+	writeInt(&buf, l.AddressB)
+	for _, s := range []string{unknown, unknown, l.GenomeBuild, l.Source, l.SourceVersion, l.SourceStrand, unknown} {
+		writeString(&buf, s)
+	}
+	buf.Write([]byte{0, 0, 0, l.AssayType})
+	if l.LocusVersion >= 7 {
+		buf.Write(make([]byte, 16))
+	}
+	if l.LocusVersion >= 8 {
+		writeString(&buf, l.RefStrand)
+	}
+	return buf.Bytes()
+}
+
+func TestNewLocusEntryVersions(t *testing.T) {
+	for _, version := range []int{6, 7, 8} {
+		want := LocusEntry{
+			LocusVersion:  version,
+			IlmnID:        "rs1-131_T_F_1234",
+			Name:          "rs1",
+			SNP:           "[A/G]",
+			Chrom:         "1",
+			MapInfo:       12345,
+			AddressA:      1000,
+			AddressB:      2000,
+			AssayType:     1,
+			GenomeBuild:   "37",
+			Source:        "dbSNP",
+			SourceVersion: "131",
+			SourceStrand:  "TOP",
+			Ploidy:        "diploid",
+			Species:       "Homo sapiens",
+			IlmnStrand:    "TOP",
+		}
+		if version >= 8 {
+			want.RefStrand = "+"
+		}
+		// Older versions may use the strings that are empty in version 8.
+		unknown := ""
+		if version < 8 {
+			unknown = "x"
+		}
+		got, err := NewLocusEntry(bytes.NewReader(encodeLocusEntry(want, unknown)))
+		if err != nil {
+			t.Fatalf("version %d: NewLocusEntry() error = %v", version, err)
+		}
+		if got != want {
+			t.Errorf("version %d: NewLocusEntry() = %+v, want %+v", version, got, want)
+		}
+	}
+
+	if _, err := NewLocusEntry(bytes.NewReader(encodeLocusEntry(LocusEntry{LocusVersion: 8}, "x"))); err == nil {
+		t.Errorf("NewLocusEntry() of version 8 entry with unexpected strings succeeded")
+	}
+	for _, version := range []int{4, 5} {
+		if _, err := NewLocusEntry(bytes.NewReader(encodeLocusEntry(LocusEntry{LocusVersion: version}, ""))); err == nil {
+			t.Errorf("NewLocusEntry() of version %d entry succeeded", version)
+		}
+	}
+}
+
+func TestNewBPMFromReader(t *testing.T) {
+	names := []string{"rs1", "rs2", "dup", "dup"}
+	entries := []LocusEntry{
+		// Entries are stored in a different order to the names.
+		{LocusVersion: 8, Name: "rs2", AddressA: 20, AddressB: 21, Chrom: "2"},
+		{LocusVersion: 8, Name: "dup", AddressA: 30, Chrom: "3"},
+		{LocusVersion: 8, Name: "rs1", AddressA: 10, Chrom: "1"},
+		{LocusVersion: 8, Name: "dup", AddressA: 40, Chrom: "4"},
+	}
+	var buf bytes.Buffer
+	buf.WriteString("BPM")
+	buf.WriteByte(1)
+	writeInt(&buf, 5|bpmVersionFlag)
+	writeString(&buf, "test.bpm")
+	writeString(&buf, "control config")
+	writeInt(&buf, len(names))
+	for i := range names {
+		writeInt(&buf, 100+i)
+	}
+	for _, name := range names {
+		writeString(&buf, name)
+	}
+	buf.Write([]byte{0, 1, 0, 1})
+	for _, l := range entries {
+		buf.Write(encodeLocusEntry(l, ""))
+	}
+
+	b, err := NewBPMFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Version != 5 || !b.VersionFlag || b.ControlConfig != "control config" || b.NumLoci != 4 {
+		t.Errorf("NewBPMFromReader() header = %d, %v, %q, %d", b.Version, b.VersionFlag, b.ControlConfig, b.NumLoci)
+	}
+	if !reflect.DeepEqual(b.Names, names) {
+		t.Errorf("Names = %v, want %v", b.Names, names)
+	}
+	for i, want := range []int{10, 20, 30, 40} {
+		l, ok := b.LocusByIndex(i)
+		if !ok || l.AddressA != want || l.Index != 100+i || l.Name != names[i] {
+			t.Errorf("LocusByIndex(%d) = %+v, %v", i, l, ok)
+		}
+	}
+	if l, ok := b.LocusByName("dup"); !ok || l.AddressA != 30 {
+		t.Errorf("LocusByName(dup) = %+v, %v", l, ok)
+	}
+	if l, ok := b.LocusByAddress(21); !ok || l.Name != "rs2" {
+		t.Errorf("LocusByAddress(21) = %+v, %v", l, ok)
+	}
+	if _, ok := b.LocusByAddress(0); ok {
+		t.Errorf("LocusByAddress(0) succeeded")
+	}
+	if _, ok := b.LocusByIndex(4); ok {
+		t.Errorf("LocusByIndex(4) succeeded")
+	}
+}
+
+func TestLocusByAddressZero(t *testing.T) {
+	loci := []LocusEntry{
+		{Name: "rs1", AddressA: 0, AddressB: 11},
+		{Name: "rs2", AddressA: 20},
+	}
+	var indexed BPM
+	indexed.SetLoci(loci)
+	// Without SetLoci there are no indexes and lookups scan the loci.
+	scanned := BPM{Names: []string{"rs1", "rs2"}, Loci: loci}
+	for name, b := range map[string]BPM{"indexed": indexed, "scanned": scanned} {
+		if l, ok := b.LocusByAddress(0); ok {
+			t.Errorf("%s: LocusByAddress(0) = %+v, want no locus", name, l)
+		}
+		if l, ok := b.LocusByAddress(11); !ok || l.Name != "rs1" {
+			t.Errorf("%s: LocusByAddress(11) = %+v, %v", name, l, ok)
+		}
+		if l, ok := b.LocusByAddress(20); !ok || l.Name != "rs2" {
+			t.Errorf("%s: LocusByAddress(20) = %+v, %v", name, l, ok)
+		}
+	}
+}
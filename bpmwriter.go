@@ -0,0 +1,104 @@
+package beadarray
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// bpmLocusVersion is the locus entry version written by WriteBPM.
+const bpmLocusVersion = 8
+
+// WriteBPM writes b to w as a manifest for NewBPMFromReader. Locus entries
+// are written in the order of b.Names, always in the version 8 layout, so
+// the manifest reads back as b except that every LocusVersion is 8. The
+// version is written with the 0x1000 flag if b.VersionFlag is set. Version 1
+// manifests have no control configuration, so b.Version must be at least 1
+// and at least 2 if b.ControlConfig is set.
+func WriteBPM(w io.Writer, b BPM) error {
+	if b.Version < 1 {
+		return fmt.Errorf("manifest version %d not supported", b.Version)
+	}
+	if b.Version == 1 && b.ControlConfig != "" {
+		return fmt.Errorf("version 1 manifests cannot hold a control configuration")
+	}
+	if len(b.NormalizationIDs) != len(b.Names) {
+		return fmt.Errorf("manifest has %d normalization IDs for %d loci", len(b.NormalizationIDs), len(b.Names))
+	}
+	loci := make([]LocusEntry, len(b.Names))
+	for i, name := range b.Names {
+		locus, ok := b.LocusByIndex(i)
+		if !ok || locus.Name != name {
+			return fmt.Errorf("manifest has no locus entry for %s", name)
+		}
+		if b.NormalizationIDs[i] >= 100 {
+			return fmt.Errorf("locus %s: invalid normalization ID %d", name, b.NormalizationIDs[i])
+		}
+		loci[i] = locus
+	}
+	version := b.Version
+	if b.VersionFlag {
+		version |= bpmVersionFlag
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := &encoder{w: bw}
+	enc.writeSlice([]byte("BPM"))
+	enc.writeByte(1)
+	enc.writeInt(version)
+	enc.writeString(b.ManifestName)
+	if b.Version > 1 {
+		enc.writeString(b.ControlConfig)
+	}
+	enc.writeInt(len(loci))
+	for _, locus := range loci {
+		enc.writeInt(locus.Index)
+	}
+	for _, locus := range loci {
+		enc.writeString(locus.Name)
+	}
+	enc.writeSlice(b.NormalizationIDs)
+	for i, locus := range loci {
+		writeLocusEntry(enc, locus, len(loci)-i)
+	}
+	if enc.err != nil {
+		return enc.err
+	}
+	return bw.Flush()
+}
+
+// writeLocusEntry writes locus in the version 8 layout read by
+// readLocusEntry, with counter in place of the descending counter found in
+// Illumina's files.
+func writeLocusEntry(enc *encoder, locus LocusEntry, counter int) {
+	enc.writeInt(bpmLocusVersion)
+	enc.writeString(locus.IlmnID)
+	enc.writeString(locus.Name)
+	for i := 0; i < 3; i++ {
+		enc.writeString("")
+	}
+	enc.writeInt(counter)
+	enc.writeString("")
+	enc.writeString(locus.IlmnStrand)
+	enc.writeString(locus.SNP)
+	enc.writeString(locus.Chrom)
+	enc.writeString(locus.Ploidy)
+	enc.writeString(locus.Species)
+	enc.writeString(strconv.Itoa(locus.MapInfo))
+	enc.writeString("")
+	enc.writeString(locus.SourceStrand)
+	enc.writeInt(locus.AddressA)
+	enc.writeInt(locus.AddressB)
+	for i := 0; i < 2; i++ {
+		enc.writeString("")
+	}
+	enc.writeString(locus.GenomeBuild)
+	enc.writeString(locus.Source)
+	enc.writeString(locus.SourceVersion)
+	enc.writeString(locus.SourceStrand)
+	enc.writeString("")
+	enc.writeSlice([]byte{0, 0, 0, locus.AssayType})
+	enc.writeSlice(make([]byte, 4*4))
+	enc.writeString(locus.RefStrand)
+}
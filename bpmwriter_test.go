@@ -0,0 +1,77 @@
+package beadarray
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteBPMRoundTrip(t *testing.T) {
+	b := testBPM(10)
+	b.ControlConfig = testControlConfig
+	b.Loci[2] = LocusEntry{
+		Index:         3,
+		LocusVersion:  8,
+		IlmnID:        "rs3-131_T_F_1234",
+		Name:          "rs3",
+		SNP:           "[A/G]",
+		Chrom:         "X",
+		MapInfo:       12345,
+		AddressA:      1000,
+		AddressB:      2000,
+		AssayType:     1,
+		RefStrand:     "+",
+		GenomeBuild:   "37",
+		Source:        "dbSNP",
+		SourceVersion: "131",
+		SourceStrand:  "TOP",
+		Ploidy:        "diploid",
+		Species:       "Homo sapiens",
+		IlmnStrand:    "TOP",
+	}
+	// Duplicate names and indexes out of order are kept.
+	b.Loci[5].Name = "rs3"
+	b.Loci[7].Index, b.Loci[8].Index = 9, 8
+	b.SetLoci(b.Loci)
+
+	v1 := testBPM(3)
+	v1.Version = 1
+	v1.VersionFlag = false
+
+	for _, want := range []BPM{b, v1} {
+		var buf bytes.Buffer
+		if err := WriteBPM(&buf, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewBPMFromReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("NewBPMFromReader(WriteBPM(b)) =\n%+v\nwant\n%+v", got, want)
+		}
+	}
+}
+
+func TestWriteBPMInvalid(t *testing.T) {
+	b := testBPM(3)
+	b.NormalizationIDs = b.NormalizationIDs[:2]
+	if err := WriteBPM(&bytes.Buffer{}, b); err == nil {
+		t.Errorf("WriteBPM() with missing normalization IDs succeeded")
+	}
+	b = testBPM(3)
+	b.NormalizationIDs[1] = 100
+	if err := WriteBPM(&bytes.Buffer{}, b); err == nil {
+		t.Errorf("WriteBPM() with invalid normalization ID succeeded")
+	}
+	b = testBPM(3)
+	b.Version = 0
+	if err := WriteBPM(&bytes.Buffer{}, b); err == nil {
+		t.Errorf("WriteBPM() of version 0 succeeded")
+	}
+	b.Version = 1
+	b.ControlConfig = testControlConfig
+	if err := WriteBPM(&bytes.Buffer{}, b); err == nil {
+		t.Errorf("WriteBPM() of version 1 with a control configuration succeeded")
+	}
+}
@@ -0,0 +1,118 @@
+package beadarray
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultGenCallThreshold is the GenCall score below which GenomeStudio
+// reports a no call.
+const DefaultGenCallThreshold = 0.15
+
+// Genotype codes, as indexes into Code2Genotype.
+const (
+	genotypeNC byte = 0
+	genotypeAA byte = 1
+	genotypeAB byte = 2
+	genotypeBB byte = 3
+)
+
+// Minimum cluster deviations, used when a cluster file records a deviation
+// of zero, e.g. for a cluster with a single sample.
+const (
+	minThetaDev = 0.01
+	minRDev     = 0.05
+)
+
+// outlierDevs is the distance from a cluster, in theta deviations, beyond
+// which the GenCall score of a call is reduced.
+const outlierDevs = 2
+
+// CallGenotype assigns a genotype to a locus with normalized intensities r
+// and theta, using the cluster positions and spreads in c. It returns the
+// genotype code, an index into Code2Genotype, and a GenCall-style score.
+//
+// Each populated cluster is modelled as independent normal distributions
+// in theta and R. The locus is assigned to the most likely cluster and the
+// score is the posterior probability of that cluster, scaled by the
+// cluster's TotalScore and by an outlier penalty that is 1 within
+// outlierDevs theta deviations of the cluster and decays as a normal tail
+// beyond. The locus is not called if r is below the cluster's
+// IntensityThreshold, if no cluster is populated or if the score is below
+// threshold. A no call with low intensity or no clusters scores 0; a no
+// call below threshold keeps its score.
+func CallGenotype(r, theta float32, c ClusterRecord, threshold float32) (byte, float32) {
+	if isNaN(r) || isNaN(theta) || (!isNaN(c.IntensityThreshold) && r < c.IntensityThreshold) {
+		return genotypeNC, 0
+	}
+	clusters := []ClusterStats{c.AAClusterStats, c.ABClusterStats, c.BBClusterStats}
+	var logL [3]float64
+	best := -1
+	for k, s := range clusters {
+		if s.N <= 0 {
+			continue
+		}
+		logL[k] = logNormal(float64(theta), float64(s.ThetaMean), math.Max(float64(s.ThetaDev), minThetaDev)) +
+			logNormal(float64(r), float64(s.RMean), math.Max(float64(s.RDev), minRDev))
+		if best < 0 || logL[k] > logL[best] {
+			best = k
+		}
+	}
+	if best < 0 {
+		return genotypeNC, 0
+	}
+	// Normalize relative to the best cluster to avoid underflow.
+	var sum float64
+	for k, s := range clusters {
+		if s.N > 0 {
+			sum += math.Exp(logL[k] - logL[best])
+		}
+	}
+	s := clusters[best]
+	z := math.Abs(float64(theta-s.ThetaMean))/math.Max(float64(s.ThetaDev), minThetaDev) - outlierDevs
+	fit := 1.0
+	if z > 0 {
+		fit = math.Exp(-0.5 * z * z)
+	}
+	score := float32(fit/sum) * c.ClusterScore.TotalScore
+	if score < threshold {
+		return genotypeNC, score
+	}
+	return genotypeAA + byte(best), score
+}
+
+// logNormal returns the log density of a normal distribution with mean mu
+// and standard deviation sigma at x.
+func logNormal(x, mu, sigma float64) float64 {
+	z := (x - mu) / sigma
+	return -0.5*z*z - math.Log(sigma) - 0.5*math.Log(2*math.Pi)
+}
+
+// CallGenotypes calls every locus from normalized R and Theta and the
+// matching cluster records. See CallGenotype.
+func CallGenotypes(rs, thetas []float32, records []ClusterRecord, threshold float32) ([]byte, []float32, error) {
+	if len(rs) != len(thetas) || len(rs) != len(records) {
+		return nil, nil, fmt.Errorf("have %d R, %d Theta values and %d cluster records", len(rs), len(thetas), len(records))
+	}
+	genotypes := make([]byte, len(rs))
+	scores := make([]float32, len(rs))
+	for i := range rs {
+		genotypes[i], scores[i] = CallGenotype(rs[i], thetas[i], records[i], threshold)
+	}
+	return genotypes, scores, nil
+}
+
+// CallGenotypes re-calls every SNP in g from its intensities, normalized
+// with b, and the clusters in e. The results are comparable to Genotypes
+// and GenotypeScores.
+func (g GTC) CallGenotypes(b BPM, e *EGT, threshold float32) ([]byte, []float32, error) {
+	records, err := e.ClusterRecordsFor(b.Names)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, thetas, err := g.PolarIntensities(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return CallGenotypes(rs, thetas, records, threshold)
+}
@@ -0,0 +1,65 @@
+package beadarray
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCallGenotype(t *testing.T) {
+	c := testClusterRecord(10, 10, 10)
+	c.IntensityThreshold = 0.2
+	c.ClusterScore.TotalScore = 0.9
+	tests := []struct {
+		name     string
+		r, theta float32
+		record   ClusterRecord
+		want     string
+		minScore float32
+	}{
+		{"AA", 1, 0.1, c, "AA", 0.8},
+		{"AB", 2, 0.52, c, "AB", 0.8},
+		{"BB", 1.05, 0.88, c, "BB", 0.8},
+		{"low intensity", 0.1, 0.5, c, "NC", 0},
+		{"between clusters", 1.5, 0.3, c, "NC", 0},
+		{"no AB cluster", 1.2, 0.14, testClusterRecordScored(10, 0, 10), "AA", 0.8},
+		{"midway with no AB cluster", 1.5, 0.5, testClusterRecordScored(10, 0, 10), "NC", 0},
+		{"no clusters", 1, 0.5, testClusterRecordScored(0, 0, 0), "NC", 0},
+		{"NaN", float32(math.NaN()), float32(math.NaN()), c, "NC", 0},
+	}
+	for _, tt := range tests {
+		code, score := CallGenotype(tt.r, tt.theta, tt.record, DefaultGenCallThreshold)
+		if got := Code2Genotype[code]; got != tt.want || score < tt.minScore || score > 1 {
+			t.Errorf("%s: CallGenotype() = %s, %v; want %s with score >= %v", tt.name, got, score, tt.want, tt.minScore)
+		}
+	}
+}
+
+func testClusterRecordScored(aaN, abN, bbN int) ClusterRecord {
+	c := testClusterRecord(aaN, abN, bbN)
+	c.ClusterScore.TotalScore = 1
+	return c
+}
+
+func TestCallGenotypes(t *testing.T) {
+	d := testGTCData(5, 10)
+	b := testBPM(10)
+	e := &EGT{Name2ClusterRecord: make(map[string]ClusterRecord)}
+	for _, name := range b.Names {
+		e.Name2ClusterRecord[name] = testClusterRecordScored(10, 10, 10)
+	}
+	g := testGTC(t, d)
+	genotypes, scores, err := g.CallGenotypes(b, e, DefaultGenCallThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, thetas, err := g.PolarIntensities(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range genotypes {
+		code, score := CallGenotype(rs[i], thetas[i], e.Name2ClusterRecord[b.Names[i]], DefaultGenCallThreshold)
+		if genotypes[i] != code || scores[i] != score {
+			t.Errorf("SNP %d: called %d, %v; want %d, %v", i, genotypes[i], scores[i], code, score)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package beadarray
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Channel is an imaging channel. X intensities are read in the red channel
+// and Y intensities in the green channel.
+type Channel int
+
+// Imaging channels.
+const (
+	Red Channel = iota
+	Green
+)
+
+func (c Channel) String() string {
+	if c == Green {
+		return "Green"
+	}
+	return "Red"
+}
+
+func (c Channel) intensity(i ControlIntensity) float64 {
+	if c == Green {
+		return float64(i.Y)
+	}
+	return float64(i.X)
+}
+
+// ControlBackground may be named in the probes of a ControlRule to stand for
+// the background of the rule's channel: the brightest extension control
+// whose base does not signal in that channel, i.e. Extension (C) and (G) in
+// red and Extension (A) and (T) in green.
+const ControlBackground = "Background"
+
+// ControlRule is a BeadArray Controls Reporter style check on the control
+// probes of a sample. In the rule's channel, the dimmest of the Signal probes
+// divided by the brightest of the Background probes must be greater than Min.
+// Probes are matched by name; the intensities of probes sharing a name are
+// averaged.
+type ControlRule struct {
+	Name       string // e.g. "Staining Red"
+	Type       ControlType
+	Channel    Channel
+	Signal     []string
+	Background []string
+	Min        float32
+}
+
+// DefaultControlRules returns the rules BeadArray Controls Reporter applies
+// to Infinium genotyping arrays.
+func DefaultControlRules() []ControlRule {
+	return []ControlRule{
+		{"Restoration Green", ControlRestoration, Green, []string{"Restore"}, []string{ControlBackground}, 0},
+		{"Staining Red", ControlStaining, Red, []string{"DNP (High)"}, []string{"DNP (Bgnd)"}, 5},
+		{"Staining Green", ControlStaining, Green, []string{"Biotin (High)"}, []string{"Biotin (Bgnd)"}, 5},
+		{"Extension Red", ControlExtension, Red, []string{"Extension (A)", "Extension (T)"}, []string{"Extension (C)", "Extension (G)"}, 5},
+		{"Extension Green", ControlExtension, Green, []string{"Extension (C)", "Extension (G)"}, []string{"Extension (A)", "Extension (T)"}, 5},
+		{"Target Removal Green", ControlTargetRemoval, Green, []string{ControlBackground}, []string{"Target Removal"}, 1},
+		{"Hybridization Green High/Medium", ControlHybridization, Green, []string{"Hyb (High)"}, []string{"Hyb (Medium)"}, 1},
+		{"Hybridization Green Medium/Low", ControlHybridization, Green, []string{"Hyb (Medium)"}, []string{"Hyb (Low)"}, 1},
+		{"Stringency Red", ControlStringency, Red, []string{"String (PM)"}, []string{"String (MM)"}, 0},
+		{"Non-Specific Binding Red", ControlNonSpecificBinding, Red, []string{ControlBackground}, []string{"NSB (Bgnd) Red", "NSB (Bgnd) Purple"}, 1},
+		{"Non-Specific Binding Green", ControlNonSpecificBinding, Green, []string{ControlBackground}, []string{"NSB (Bgnd) Green", "NSB (Bgnd) Blue"}, 1},
+		{"Non-Polymorphic Red", ControlNonPolymorphic, Red, []string{"NP (A)", "NP (T)"}, []string{"NP (C)", "NP (G)"}, 5},
+		{"Non-Polymorphic Green", ControlNonPolymorphic, Green, []string{"NP (C)", "NP (G)"}, []string{"NP (A)", "NP (T)"}, 5},
+	}
+}
+
+// ControlResult is the outcome of a ControlRule for one sample. A rule
+// naming a probe the sample does not have is not evaluated: Evaluated and
+// Pass are false, Value is NaN and Missing lists the absent probes.
+type ControlResult struct {
+	Rule      string
+	Type      ControlType
+	Value     float32 // the signal to background ratio
+	Min       float32
+	Evaluated bool
+	Pass      bool
+	Missing   []string
+}
+
+// ControlReport is the control probe QC of one sample.
+type ControlReport struct {
+	Sample  string
+	Results []ControlResult
+}
+
+// Pass reports whether the sample passed every rule that was evaluated. It
+// is false if no rule could be evaluated, as happens when the probe names
+// in the manifest do not match those of the rules.
+func (r ControlReport) Pass() bool {
+	evaluated := false
+	for _, res := range r.Results {
+		if res.Evaluated && !res.Pass {
+			return false
+		}
+		evaluated = evaluated || res.Evaluated
+	}
+	return evaluated
+}
+
+// Failed returns the results of the rules the sample failed.
+func (r ControlReport) Failed() []ControlResult {
+	var failed []ControlResult
+	for _, res := range r.Results {
+		if res.Evaluated && !res.Pass {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// NotEvaluated returns the results of the rules that could not be evaluated
+// because the sample lacks one of their probes.
+func (r ControlReport) NotEvaluated() []ControlResult {
+	var skipped []ControlResult
+	for _, res := range r.Results {
+		if !res.Evaluated {
+			skipped = append(skipped, res)
+		}
+	}
+	return skipped
+}
+
+// CheckControls applies rules to the control intensities of a sample and
+// returns one result per rule, in order. Rules naming a probe the sample
+// does not have are reported as not evaluated, since not every array
+// carries every control.
+func CheckControls(intensities []ControlIntensity, rules []ControlRule) []ControlResult {
+	sums := make(map[string][2]float64)
+	counts := make(map[string]int)
+	for _, i := range intensities {
+		s := sums[i.Name]
+		s[Red] += Red.intensity(i)
+		s[Green] += Green.intensity(i)
+		sums[i.Name] = s
+		counts[i.Name]++
+	}
+	mean := func(name string, c Channel) (float64, []string) {
+		n := counts[name]
+		if n == 0 {
+			return 0, []string{name}
+		}
+		return sums[name][c] / float64(n), nil
+	}
+	background := func(c Channel) (float64, []string) {
+		bases := []string{"Extension (A)", "Extension (T)"}
+		if c == Red {
+			bases = []string{"Extension (C)", "Extension (G)"}
+		}
+		return extremum(bases, c, mean, math.Max)
+	}
+	value := func(names []string, c Channel, pick func(x, y float64) float64) (float64, []string) {
+		return extremum(names, c, func(name string, c Channel) (float64, []string) {
+			if name == ControlBackground {
+				return background(c)
+			}
+			return mean(name, c)
+		}, pick)
+	}
+
+	results := make([]ControlResult, len(rules))
+	for i, rule := range rules {
+		signal, missing := value(rule.Signal, rule.Channel, math.Min)
+		bgnd, missingBgnd := value(rule.Background, rule.Channel, math.Max)
+		missing = append(missing, missingBgnd...)
+		res := ControlResult{
+			Rule:    rule.Name,
+			Type:    rule.Type,
+			Value:   float32(math.NaN()),
+			Min:     rule.Min,
+			Missing: missing,
+		}
+		if len(missing) == 0 && len(rule.Signal) > 0 && len(rule.Background) > 0 {
+			// No signal fails whatever the background.
+			switch {
+			case signal == 0:
+				res.Value = 0
+			case bgnd == 0:
+				res.Value = float32(math.Inf(1))
+			default:
+				res.Value = float32(signal / bgnd)
+			}
+			res.Evaluated = true
+			res.Pass = res.Value > rule.Min
+		}
+		results[i] = res
+	}
+	return results
+}
+
+// extremum combines the intensities of names with pick. It also returns the
+// names that have no intensity.
+func extremum(names []string, c Channel, intensity func(string, Channel) (float64, []string), pick func(x, y float64) float64) (float64, []string) {
+	var r float64
+	var missing []string
+	for i, name := range names {
+		x, m := intensity(name, c)
+		missing = append(missing, m...)
+		if i == 0 {
+			r = x
+		} else {
+			r = pick(r, x)
+		}
+	}
+	return r, missing
+}
+
+// ControlReport checks the control intensities of g against rules, using
+// the control probes of the manifest g was called with.
+func (g GTC) ControlReport(probes []ControlProbe, rules []ControlRule) (ControlReport, error) {
+	name, err := g.SampleName()
+	if err != nil {
+		return ControlReport{}, err
+	}
+	intensities, err := g.ControlIntensities(probes)
+	if err != nil {
+		return ControlReport{}, err
+	}
+	return ControlReport{Sample: name, Results: CheckControls(intensities, rules)}, nil
+}
+
+// ControlReports checks the control intensities of every GTC against rules,
+// using the control probes of b.
+func ControlReports(b BPM, gtcs []GTC, rules []ControlRule) ([]ControlReport, error) {
+	probes, err := b.ControlProbes()
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]ControlReport, len(gtcs))
+	for i, g := range gtcs {
+		if reports[i], err = g.ControlReport(probes, rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", g.Filename(), err)
+		}
+	}
+	return reports, nil
+}
+
+// WriteControlReportsTSV writes reports to w as tab separated values with
+// the columns Sample, Rule, Type, Value, Min, Result and Missing. Result is
+// "PASS", "FAIL" or, for rules that could not be evaluated, "NOT_EVALUATED",
+// in which case Missing lists the absent probes separated by semicolons.
+func WriteControlReportsTSV(w io.Writer, reports []ControlReport) error {
+	bw := bufio.NewWriter(w)
+	row := func(cols ...string) {
+		bw.WriteString(strings.Join(cols, "\t"))
+		bw.WriteByte('\n')
+	}
+	row("Sample", "Rule", "Type", "Value", "Min", "Result", "Missing")
+	for _, r := range reports {
+		for _, res := range r.Results {
+			result := "FAIL"
+			switch {
+			case !res.Evaluated:
+				result = "NOT_EVALUATED"
+			case res.Pass:
+				result = "PASS"
+			}
+			row(r.Sample, res.Rule, string(res.Type), formatFloat32(res.Value), formatFloat32(res.Min), result, strings.Join(res.Missing, ";"))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,126 @@
+package beadarray
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCheckControls(t *testing.T) {
+	intensities := []ControlIntensity{
+		{ControlProbe{Name: "DNP (High)"}, 10000, 100},
+		{ControlProbe{Name: "DNP (Bgnd)"}, 1000, 100},
+		{ControlProbe{Name: "Biotin (High)"}, 100, 3000},
+		{ControlProbe{Name: "Biotin (Bgnd)"}, 100, 1000},
+		{ControlProbe{Name: "Extension (A)"}, 8000, 200},
+		{ControlProbe{Name: "Extension (T)"}, 6000, 300},
+		{ControlProbe{Name: "Extension (C)"}, 400, 9000},
+		{ControlProbe{Name: "Extension (G)"}, 200, 7000},
+		{ControlProbe{Name: "Target Removal"}, 100, 150},
+		{ControlProbe{Name: "Target Removal"}, 100, 250},
+		{ControlProbe{Name: "Hyb (High)"}, 100, 4000},
+		{ControlProbe{Name: "Hyb (Medium)"}, 100, 2000},
+		{ControlProbe{Name: "Hyb (Low)"}, 100, 2000},
+		{ControlProbe{Name: "String (PM)"}, 0, 0},
+		{ControlProbe{Name: "String (MM)"}, 0, 0},
+	}
+	results := CheckControls(intensities, DefaultControlRules())
+	if len(results) != len(DefaultControlRules()) {
+		t.Fatalf("CheckControls() = %d results, want one per rule", len(results))
+	}
+	want := map[string]struct {
+		value float32
+		pass  bool
+	}{
+		"Staining Red":         {10, true},
+		"Staining Green":       {3, false},
+		"Extension Red":        {15, true},
+		"Extension Green":      {7000.0 / 300, true},
+		"Target Removal Green": {1.5, true},
+		// Each hybridization level must be brighter than the next.
+		"Hybridization Green High/Medium": {2, true},
+		"Hybridization Green Medium/Low":  {1, false},
+		// No signal over no background fails.
+		"Stringency Red": {0, false},
+	}
+	for _, r := range results {
+		w, ok := want[r.Rule]
+		if !ok {
+			if r.Evaluated || r.Pass || !math.IsNaN(float64(r.Value)) || len(r.Missing) == 0 {
+				t.Errorf("%s = %+v, want not evaluated", r.Rule, r)
+			}
+			continue
+		}
+		if !r.Evaluated || abs32(r.Value-w.value) > 1e-4 || r.Pass != w.pass {
+			t.Errorf("%s = %+v, want %v pass %v", r.Rule, r, w.value, w.pass)
+		}
+	}
+
+	// A ratio equal to the minimum fails.
+	rule := ControlRule{"Staining Red", ControlStaining, Red, []string{"DNP (High)"}, []string{"DNP (Bgnd)"}, 10}
+	if r := CheckControls(intensities, []ControlRule{rule}); r[0].Pass {
+		t.Errorf("ratio equal to Min = %+v, want fail", r[0])
+	}
+}
+
+func TestControlReportNothingEvaluated(t *testing.T) {
+	r := ControlReport{Results: CheckControls(nil, DefaultControlRules())}
+	if r.Pass() {
+		t.Errorf("Pass() with no rules evaluated = true")
+	}
+	if n := len(r.NotEvaluated()); n != len(DefaultControlRules()) {
+		t.Errorf("NotEvaluated() = %d results, want %d", n, len(DefaultControlRules()))
+	}
+	if n := len(r.Failed()); n != 0 {
+		t.Errorf("Failed() = %d results, want 0", n)
+	}
+}
+
+func TestControlReports(t *testing.T) {
+	b := testBPM(10)
+	b.ControlConfig = "1,Staining,Red,DNP (High)\n2,Staining,Purple,DNP (Bgnd)\n3,Staining,Green,Biotin (High)\n4,Staining,Blue,Biotin (Bgnd)\n"
+	d := testGTCData(5, 10)
+	d.ControlsX = []uint16{5000, 500, 100, 100}
+	d.ControlsY = []uint16{100, 100, 6000, 1000}
+	pass := testGTC(t, d)
+	d.SampleName = "sample2"
+	d.ControlsY = []uint16{100, 100, 500, 200}
+	fail := testGTC(t, d)
+
+	rules := DefaultControlRules()
+	rules = []ControlRule{rules[1], rules[2], rules[7]}
+	reports, err := ControlReports(b, []GTC{pass, fail}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || !reports[0].Pass() || reports[1].Pass() {
+		t.Fatalf("ControlReports() = %+v", reports)
+	}
+	if failed := reports[1].Failed(); len(failed) != 1 || failed[0].Rule != "Staining Green" {
+		t.Errorf("Failed() = %+v", failed)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteControlReportsTSV(&buf, reports); err != nil {
+		t.Fatal(err)
+	}
+	want := "Sample\tRule\tType\tValue\tMin\tResult\tMissing\n" +
+		"sample1\tStaining Red\tStaining\t10\t5\tPASS\t\n" +
+		"sample1\tStaining Green\tStaining\t6\t5\tPASS\t\n" +
+		"sample1\tHybridization Green Medium/Low\tHybridization\tNaN\t1\tNOT_EVALUATED\tHyb (Medium);Hyb (Low)\n" +
+		"sample2\tStaining Red\tStaining\t10\t5\tPASS\t\n" +
+		"sample2\tStaining Green\tStaining\t2.5\t5\tFAIL\t\n" +
+		"sample2\tHybridization Green Medium/Low\tHybridization\tNaN\t1\tNOT_EVALUATED\tHyb (Medium);Hyb (Low)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteControlReportsTSV() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Errors reading a GTC keep their type.
+	truncated := fail
+	truncated.size = int64(truncated.toc[FieldSampleName] + 1)
+	var pe *ParseError
+	if _, err := ControlReports(b, []GTC{truncated}, rules); !errors.As(err, &pe) {
+		t.Errorf("ControlReports() of truncated GTC error = %v, want *ParseError", err)
+	}
+}
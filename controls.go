@@ -0,0 +1,103 @@
+package beadarray
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ControlType is the category of a control probe.
+type ControlType string
+
+// Control probe types found in Infinium manifests.
+const (
+	ControlStaining           ControlType = "Staining"
+	ControlExtension          ControlType = "Extension"
+	ControlHybridization      ControlType = "Hybridization"
+	ControlTargetRemoval      ControlType = "Target Removal"
+	ControlStringency         ControlType = "Stringency"
+	ControlNonSpecificBinding ControlType = "Non-Specific Binding"
+	ControlNonPolymorphic     ControlType = "Non-Polymorphic"
+	ControlRestoration        ControlType = "Restoration"
+)
+
+// ControlProbe is a control bead type listed in the control configuration
+// of a manifest.
+type ControlProbe struct {
+	Address int
+	Type    ControlType
+	Color   string // e.g. "Red" or "Green"
+	Name    string // e.g. "DNP (High)"
+}
+
+// ParseControlConfig parses the control configuration of a manifest. Each
+// non-empty line describes one control probe as "address,type,color,name";
+// lines with the address last instead are accepted too. Probes are returned
+// in the order of the lines, which is the order of the control intensities
+// in a GTC.
+func ParseControlConfig(config string) ([]ControlProbe, error) {
+	var probes []ControlProbe
+	for i, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("control config line %d: expected 4 fields, got %q", i+1, line)
+		}
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+		address, err := strconv.Atoi(fields[0])
+		if err == nil {
+			fields = fields[1:]
+		} else if address, err = strconv.Atoi(fields[len(fields)-1]); err == nil {
+			fields = fields[:len(fields)-1]
+		} else {
+			return nil, fmt.Errorf("control config line %d: no address in %q", i+1, line)
+		}
+		probes = append(probes, ControlProbe{
+			Address: address,
+			Type:    ControlType(fields[0]),
+			Color:   fields[1],
+			// Names may themselves contain commas.
+			Name: strings.Join(fields[2:], ","),
+		})
+	}
+	return probes, nil
+}
+
+// ControlProbes returns the control probes of the manifest.
+func (b BPM) ControlProbes() ([]ControlProbe, error) {
+	return ParseControlConfig(b.ControlConfig)
+}
+
+// ControlIntensity is a control probe with its intensities in a sample.
+type ControlIntensity struct {
+	ControlProbe
+	X uint16
+	Y uint16
+}
+
+// ControlIntensities pairs probes, usually from BPM.ControlProbes, with the
+// control intensities of g. It returns an error if g does not have one
+// intensity per probe.
+func (g GTC) ControlIntensities(probes []ControlProbe) ([]ControlIntensity, error) {
+	xs, err := g.ControlXIntensities()
+	if err != nil {
+		return nil, err
+	}
+	ys, err := g.ControlYIntensities()
+	if err != nil {
+		return nil, err
+	}
+	if len(xs) != len(probes) || len(ys) != len(probes) {
+		return nil, fmt.Errorf("GTC has %d X and %d Y control intensities for %d control probes", len(xs), len(ys), len(probes))
+	}
+	r := make([]ControlIntensity, len(probes))
+	for i, p := range probes {
+		r[i] = ControlIntensity{ControlProbe: p, X: xs[i], Y: ys[i]}
+	}
+	return r, nil
+}
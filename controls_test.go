@@ -0,0 +1,51 @@
+package beadarray
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testControlConfig = "0027630314,Staining,Red,DNP (High)\r\n" +
+	"0029619375,Staining,Purple,DNP (Bgnd)\r\n" +
+	"\r\n" +
+	"Extension,Red,Extension (A),0013643391\r\n"
+
+func TestParseControlConfig(t *testing.T) {
+	got, err := ParseControlConfig(testControlConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ControlProbe{
+		{27630314, ControlStaining, "Red", "DNP (High)"},
+		{29619375, ControlStaining, "Purple", "DNP (Bgnd)"},
+		{13643391, ControlExtension, "Red", "Extension (A)"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseControlConfig() = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"123,Staining,Red", "Staining,Red,DNP,High"} {
+		if _, err := ParseControlConfig(bad); err == nil {
+			t.Errorf("ParseControlConfig(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestControlIntensities(t *testing.T) {
+	b := testBPM(10)
+	b.ControlConfig = testControlConfig
+	probes, err := b.ControlProbes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := testGTC(t, testGTCData(5, 10)).ControlIntensities(probes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[1].Name != "DNP (Bgnd)" || got[1].X != 200 || got[1].Y != 500 {
+		t.Errorf("ControlIntensities() = %+v", got)
+	}
+	if _, err := testGTC(t, testGTCData(5, 10)).ControlIntensities(probes[:2]); err == nil {
+		t.Errorf("ControlIntensities() with too few probes succeeded")
+	}
+}
@@ -0,0 +1,217 @@
+package beadarray
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// The functions in this file read the little-endian arrays stored in GTC,
+// EGT and BPM files.
+//
+// On little-endian hosts the file bytes are already in the host
+// representation, so they are read directly into the memory of the typed
+// destination slice. Because the destination is allocated with its own
+// element type it is always correctly aligned, unlike a []byte
+// reinterpreted as a []float32. On other hosts the bytes are read through a
+// fixed size chunk and converted with the encoding/binary byte order
+// functions.
+
+// decodeChunk is the size of the buffer used to read arrays on big-endian
+// hosts.
+const decodeChunk = 32 << 10
+
+// maxDirect is the largest array, in bytes, read directly into its
+// destination. It bounds the array type used by asBytes.
+const maxDirect = 1 << 30
+
+// hostLittleEndian reports whether the host stores integers little-endian.
+var hostLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// asBytes returns the n bytes of memory starting at p, which must be the
+// address of the first element of a slice at least n bytes long.
+func asBytes(p unsafe.Pointer, n int) []byte {
+	return (*[maxDirect]byte)(p)[:n:n]
+}
+
+// readDirect reads n bytes from r into the memory starting at p when the
+// host byte order matches the file. It reports false if the caller must
+// decode the values itself.
+func readDirect(r io.Reader, p unsafe.Pointer, n int) (bool, error) {
+	if !hostLittleEndian || n == 0 || n > maxDirect {
+		return false, nil
+	}
+	if _, err := io.ReadFull(r, asBytes(p, n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return true, err
+	}
+	return true, nil
+}
+
+// Each decode function decodes len(src)/size values into the start of dst,
+// which must be at least that long.
+
+func decodeInt16s(dst []int16, src []byte) {
+	dst = dst[:len(src)/2]
+	for i := range dst {
+		dst[i] = int16(binary.LittleEndian.Uint16(src[i*2:]))
+	}
+}
+
+func decodeUint16s(dst []uint16, src []byte) {
+	dst = dst[:len(src)/2]
+	for i := range dst {
+		dst[i] = binary.LittleEndian.Uint16(src[i*2:])
+	}
+}
+
+func decodeInt32s(dst []int32, src []byte) {
+	dst = dst[:len(src)/4]
+	for i := range dst {
+		dst[i] = int32(binary.LittleEndian.Uint32(src[i*4:]))
+	}
+}
+
+func decodeFloat32s(dst []float32, src []byte) {
+	dst = dst[:len(src)/4]
+	for i := range dst {
+		dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(src[i*4:]))
+	}
+}
+
+// readChunked reads n elements of size bytes from r, calling decode with
+// the start index and bytes of each run of complete elements.
+func readChunked(r io.Reader, n, size int, decode func(i int, b []byte)) error {
+	chunk := decodeChunk / size * size
+	if n*size < chunk {
+		chunk = n * size
+	}
+	buf := make([]byte, chunk)
+	for i := 0; i < n; {
+		m := n - i
+		if m*size > chunk {
+			m = chunk / size
+		}
+		b := buf[:m*size]
+		if _, err := io.ReadFull(r, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		decode(i, b)
+		i += m
+	}
+	return nil
+}
+
+// readInt16sInto fills dst with little-endian int16 values read from r.
+func readInt16sInto(r io.Reader, dst []int16) error {
+	if len(dst) > 0 {
+		if ok, err := readDirect(r, unsafe.Pointer(&dst[0]), len(dst)*2); ok {
+			return err
+		}
+	}
+	return readChunked(r, len(dst), 2, func(i int, b []byte) { decodeInt16s(dst[i:], b) })
+}
+
+// readUint16sInto fills dst with little-endian uint16 values read from r.
+func readUint16sInto(r io.Reader, dst []uint16) error {
+	if len(dst) > 0 {
+		if ok, err := readDirect(r, unsafe.Pointer(&dst[0]), len(dst)*2); ok {
+			return err
+		}
+	}
+	return readChunked(r, len(dst), 2, func(i int, b []byte) { decodeUint16s(dst[i:], b) })
+}
+
+// readInt32sInto fills dst with little-endian int32 values read from r.
+func readInt32sInto(r io.Reader, dst []int32) error {
+	if len(dst) > 0 {
+		if ok, err := readDirect(r, unsafe.Pointer(&dst[0]), len(dst)*4); ok {
+			return err
+		}
+	}
+	return readChunked(r, len(dst), 4, func(i int, b []byte) { decodeInt32s(dst[i:], b) })
+}
+
+// readFloat32sInto fills dst with little-endian float32 values read from r.
+func readFloat32sInto(r io.Reader, dst []float32) error {
+	if len(dst) > 0 {
+		if ok, err := readDirect(r, unsafe.Pointer(&dst[0]), len(dst)*4); ok {
+			return err
+		}
+	}
+	return readChunked(r, len(dst), 4, func(i int, b []byte) { decodeFloat32s(dst[i:], b) })
+}
+
+// The read*s functions read n values whose count has not been checked
+// against the size of the input. Their result grows as data arrives, a
+// chunk at a time, so a corrupt count cannot exhaust memory.
+
+func readInt16s(r io.Reader, n int) ([]int16, error) {
+	xs := make([]int16, 0, capHint(n))
+	for len(xs) < n {
+		m := growBy(len(xs), n)
+		xs = append(xs, make([]int16, m)...)
+		if err := readInt16sInto(r, xs[len(xs)-m:]); err != nil {
+			return nil, err
+		}
+	}
+	return xs, nil
+}
+
+func readUint16s(r io.Reader, n int) ([]uint16, error) {
+	xs := make([]uint16, 0, capHint(n))
+	for len(xs) < n {
+		m := growBy(len(xs), n)
+		xs = append(xs, make([]uint16, m)...)
+		if err := readUint16sInto(r, xs[len(xs)-m:]); err != nil {
+			return nil, err
+		}
+	}
+	return xs, nil
+}
+
+func readInt32s(r io.Reader, n int) ([]int32, error) {
+	xs := make([]int32, 0, capHint(n))
+	for len(xs) < n {
+		m := growBy(len(xs), n)
+		xs = append(xs, make([]int32, m)...)
+		if err := readInt32sInto(r, xs[len(xs)-m:]); err != nil {
+			return nil, err
+		}
+	}
+	return xs, nil
+}
+
+func readFloat32s(r io.Reader, n int) ([]float32, error) {
+	xs := make([]float32, 0, capHint(n))
+	for len(xs) < n {
+		m := growBy(len(xs), n)
+		xs = append(xs, make([]float32, m)...)
+		if err := readFloat32sInto(r, xs[len(xs)-m:]); err != nil {
+			return nil, err
+		}
+	}
+	return xs, nil
+}
+
+// growBy returns how many elements to add to a slice of length have that is
+// growing towards want: at least capHint(want) and at most doubling.
+func growBy(have, want int) int {
+	m := have
+	if m < capHint(want) {
+		m = capHint(want)
+	}
+	if have+m > want {
+		m = want - have
+	}
+	return m
+}
@@ -0,0 +1,147 @@
+package beadarray
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The reference decoders assemble each value a byte at a time, independent
+// of both encoding/binary and the host byte order.
+
+func refUint16(b []byte) uint16 {
+	return uint16(b[0]) | uint16(b[1])<<8
+}
+
+func refUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func randomBytes(n int) []byte {
+	bs := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(bs)
+	return bs
+}
+
+// decodeLengths covers empty input and runs either side of the chunk size.
+var decodeLengths = []int{0, 1, 3, decodeChunk/4 - 1, decodeChunk / 4, decodeChunk/2 + 1, 3*decodeChunk + 7}
+
+// withByteOrderPaths runs f with direct reads enabled, if the host supports
+// them, and with the portable chunked decoder.
+func withByteOrderPaths(t *testing.T, f func(t *testing.T)) {
+	t.Run("host", f)
+	saved := hostLittleEndian
+	hostLittleEndian = false
+	defer func() { hostLittleEndian = saved }()
+	t.Run("portable", f)
+}
+
+func TestReadInt16sInto(t *testing.T) {
+	withByteOrderPaths(t, func(t *testing.T) {
+		for _, n := range decodeLengths {
+			bs := randomBytes(n * 2)
+			got := make([]int16, n)
+			if err := readInt16sInto(bytes.NewReader(bs), got); err != nil {
+				t.Fatalf("n = %d: readInt16sInto() error = %v", n, err)
+			}
+			for i := range got {
+				if want := int16(refUint16(bs[i*2:])); got[i] != want {
+					t.Fatalf("n = %d: got[%d] = %v, want %v", n, i, got[i], want)
+				}
+			}
+		}
+	})
+}
+
+func TestReadUint16sInto(t *testing.T) {
+	withByteOrderPaths(t, func(t *testing.T) {
+		for _, n := range decodeLengths {
+			bs := randomBytes(n * 2)
+			got := make([]uint16, n)
+			if err := readUint16sInto(bytes.NewReader(bs), got); err != nil {
+				t.Fatalf("n = %d: readUint16sInto() error = %v", n, err)
+			}
+			for i := range got {
+				if want := refUint16(bs[i*2:]); got[i] != want {
+					t.Fatalf("n = %d: got[%d] = %v, want %v", n, i, got[i], want)
+				}
+			}
+		}
+	})
+}
+
+func TestReadInt32sInto(t *testing.T) {
+	withByteOrderPaths(t, func(t *testing.T) {
+		for _, n := range decodeLengths {
+			bs := randomBytes(n * 4)
+			got := make([]int32, n)
+			if err := readInt32sInto(bytes.NewReader(bs), got); err != nil {
+				t.Fatalf("n = %d: readInt32sInto() error = %v", n, err)
+			}
+			for i := range got {
+				if want := int32(refUint32(bs[i*4:])); got[i] != want {
+					t.Fatalf("n = %d: got[%d] = %v, want %v", n, i, got[i], want)
+				}
+			}
+		}
+	})
+}
+
+func TestReadFloat32sInto(t *testing.T) {
+	withByteOrderPaths(t, func(t *testing.T) {
+		for _, n := range decodeLengths {
+			bs := randomBytes(n * 4)
+			got := make([]float32, n)
+			if err := readFloat32sInto(bytes.NewReader(bs), got); err != nil {
+				t.Fatalf("n = %d: readFloat32sInto() error = %v", n, err)
+			}
+			for i := range got {
+				// Compare bits so NaN payloads are checked too.
+				if want := refUint32(bs[i*4:]); math.Float32bits(got[i]) != want {
+					t.Fatalf("n = %d: got[%d] = %#x, want %#x", n, i, math.Float32bits(got[i]), want)
+				}
+			}
+		}
+	})
+}
+
+func TestReadFloat32sTruncated(t *testing.T) {
+	withByteOrderPaths(t, func(t *testing.T) {
+		bs := randomBytes(decodeChunk*2 + 3)
+		if _, err := readFloat32s(bytes.NewReader(bs), decodeChunk); err == nil {
+			t.Errorf("readFloat32s() of truncated input succeeded, want error")
+		}
+		xs, err := readFloat32s(bytes.NewReader(bs), len(bs)/4)
+		if err != nil || len(xs) != len(bs)/4 {
+			t.Errorf("readFloat32s() = %d values, %v; want %d values", len(xs), err, len(bs)/4)
+		}
+	})
+}
+
+func BenchmarkReadInt32s(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := readInt32s(bytes.NewReader(bb.Bytes()), n); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadFloat32s(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := readFloat32s(bytes.NewReader(bb.Bytes()), n); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadFloat32sPortable(b *testing.B) {
+	saved := hostLittleEndian
+	hostLittleEndian = false
+	defer func() { hostLittleEndian = saved }()
+	for i := 0; i < b.N; i++ {
+		if _, err := readFloat32s(bytes.NewReader(bb.Bytes()), n); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
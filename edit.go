@@ -0,0 +1,196 @@
+package beadarray
+
+import (
+	"fmt"
+)
+
+// Cluster identifies one of the three clusters of a ClusterRecord.
+type Cluster int
+
+// Clusters of a ClusterRecord.
+const (
+	ClusterAA Cluster = iota
+	ClusterAB
+	ClusterBB
+)
+
+// ClusterAll stands for every cluster of a locus in the Edit log.
+const ClusterAll Cluster = -1
+
+func (c Cluster) String() string {
+	switch c {
+	case ClusterAA:
+		return "AA"
+	case ClusterAB:
+		return "AB"
+	case ClusterBB:
+		return "BB"
+	case ClusterAll:
+		return "all"
+	}
+	return fmt.Sprintf("Cluster(%d)", int(c))
+}
+
+// stats returns a pointer to the statistics of cluster c in record.
+func (c Cluster) stats(record *ClusterRecord) (*ClusterStats, error) {
+	switch c {
+	case ClusterAA:
+		return &record.AAClusterStats, nil
+	case ClusterAB:
+		return &record.ABClusterStats, nil
+	case ClusterBB:
+		return &record.BBClusterStats, nil
+	}
+	return nil, fmt.Errorf("invalid cluster %v", c)
+}
+
+// EditOp is the kind of change recorded in an Edit.
+type EditOp string
+
+// Edit operations.
+const (
+	EditMove  EditOp = "move"
+	EditReset EditOp = "reset"
+	EditZero  EditOp = "zero"
+)
+
+// Edit records a change made to a locus through the editing methods of EGT.
+type Edit struct {
+	Locus   string
+	Op      EditOp
+	Cluster Cluster // the cluster moved or reset; ClusterAll for locus-wide edits
+	Before  ClusterRecord
+	After   ClusterRecord
+}
+
+// MoveCluster moves cluster c of the named locus to theta and r. The
+// cluster separation is recomputed and the record marked as edited.
+func (e *EGT) MoveCluster(name string, c Cluster, theta, r float32) error {
+	return e.edit(name, EditMove, c, func(record *ClusterRecord) error {
+		s, err := c.stats(record)
+		if err != nil {
+			return err
+		}
+		s.ThetaMean = theta
+		s.RMean = r
+		record.ClusterScore.ClusterSeparation = ClusterSeparation(*record)
+		record.ClusterScore.Edited = true
+		return nil
+	})
+}
+
+// ResetCluster restores cluster c of the named locus to its state before
+// the locus was first edited. If no other edits to the locus remain its
+// cluster score is restored too.
+func (e *EGT) ResetCluster(name string, c Cluster) error {
+	original, ok := e.originalRecord(name)
+	if !ok {
+		return e.checkLocus(name)
+	}
+	return e.edit(name, EditReset, c, func(record *ClusterRecord) error {
+		s, err := c.stats(record)
+		if err != nil {
+			return err
+		}
+		orig, _ := c.stats(&original)
+		*s = *orig
+		score := record.ClusterScore
+		record.ClusterScore = original.ClusterScore
+		if !sameEditedFields(*record, original) || floatChanged(score.TotalScore, original.ClusterScore.TotalScore, 0) {
+			// Other edits to the locus remain.
+			record.ClusterScore = score
+			record.ClusterScore.ClusterSeparation = ClusterSeparation(*record)
+		}
+		return nil
+	})
+}
+
+// ResetLocus restores the named locus to its state before it was first
+// edited. It does nothing if the locus has not been edited.
+func (e *EGT) ResetLocus(name string) error {
+	original, ok := e.originalRecord(name)
+	if !ok {
+		return e.checkLocus(name)
+	}
+	return e.edit(name, EditReset, ClusterAll, func(record *ClusterRecord) error {
+		*record = original
+		return nil
+	})
+}
+
+// ZeroLocus zeroes the total score of the named locus, so that GenCall
+// calls no samples at it, and marks it as edited.
+func (e *EGT) ZeroLocus(name string) error {
+	return e.edit(name, EditZero, ClusterAll, func(record *ClusterRecord) error {
+		record.ClusterScore.TotalScore = 0
+		record.ClusterScore.Edited = true
+		return nil
+	})
+}
+
+// EditLog returns a copy of the edits made to e, oldest first.
+func (e *EGT) EditLog() []Edit {
+	return append([]Edit(nil), e.edits...)
+}
+
+// edit applies f to the record of the named locus and logs the change.
+func (e *EGT) edit(name string, op EditOp, c Cluster, f func(*ClusterRecord) error) error {
+	record, ok := e.findRecord(name)
+	if !ok {
+		return fmt.Errorf("cluster file has no record for locus %s", name)
+	}
+	before := record
+	if err := f(&record); err != nil {
+		return err
+	}
+	if sameEditedFields(record, before) {
+		return nil
+	}
+	if i, ok := e.RecordIndex(name); ok {
+		e.ClusterRecords[i] = record
+	}
+	if _, ok := e.Name2ClusterRecord[name]; ok {
+		e.Name2ClusterRecord[name] = record
+	}
+	e.edits = append(e.edits, Edit{Locus: name, Op: op, Cluster: c, Before: before, After: record})
+	return nil
+}
+
+// originalRecord returns the record of the named locus before its first
+// logged edit.
+func (e *EGT) originalRecord(name string) (ClusterRecord, bool) {
+	for _, edit := range e.edits {
+		if edit.Locus == name {
+			return edit.Before, true
+		}
+	}
+	return ClusterRecord{}, false
+}
+
+// sameEditedFields reports whether a and b agree in the fields the editing
+// methods change: the cluster statistics and the cluster score. NaN equals
+// NaN, so that records with undefined statistics compare equal to
+// themselves.
+func sameEditedFields(a, b ClusterRecord) bool {
+	for _, c := range []Cluster{ClusterAA, ClusterAB, ClusterBB} {
+		x, _ := c.stats(&a)
+		y, _ := c.stats(&b)
+		if x.N != y.N ||
+			floatChanged(x.ThetaMean, y.ThetaMean, 0) || floatChanged(x.ThetaDev, y.ThetaDev, 0) ||
+			floatChanged(x.RMean, y.RMean, 0) || floatChanged(x.RDev, y.RDev, 0) {
+			return false
+		}
+	}
+	sa, sb := a.ClusterScore, b.ClusterScore
+	return sa.Edited == sb.Edited &&
+		!floatChanged(sa.ClusterSeparation, sb.ClusterSeparation, 0) &&
+		!floatChanged(sa.TotalScore, sb.TotalScore, 0) &&
+		!floatChanged(sa.OriginalScore, sb.OriginalScore, 0)
+}
+
+func (e *EGT) checkLocus(name string) error {
+	if _, ok := e.findRecord(name); !ok {
+		return fmt.Errorf("cluster file has no record for locus %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package beadarray
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEditEGT(t *testing.T) {
+	e := testEGT(3)
+	original, _ := e.RecordByName("rs1")
+
+	if err := e.MoveCluster("rs1", ClusterBB, 0.7, 1.2); err != nil {
+		t.Fatal(err)
+	}
+	moved, _ := e.RecordByName("rs1")
+	if moved.BBClusterStats.ThetaMean != 0.7 || moved.BBClusterStats.RMean != 1.2 || !moved.ClusterScore.Edited {
+		t.Errorf("after MoveCluster() record = %+v", moved)
+	}
+	if want := ClusterSeparation(moved); moved.ClusterScore.ClusterSeparation != want {
+		t.Errorf("ClusterSeparation = %v, want %v", moved.ClusterScore.ClusterSeparation, want)
+	}
+	if e.Name2ClusterRecord["rs1"] != moved {
+		t.Errorf("Name2ClusterRecord not updated")
+	}
+
+	if err := e.MoveCluster("rs1", ClusterAA, 0.15, 1.1); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ResetCluster("rs1", ClusterAA); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := e.RecordByName("rs1"); r != moved {
+		t.Errorf("after ResetCluster(AA) record = %+v, want %+v", r, moved)
+	}
+	if err := e.ResetCluster("rs1", ClusterBB); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := e.RecordByName("rs1"); r != original {
+		t.Errorf("after ResetCluster(BB) record = %+v, want original %+v", r, original)
+	}
+
+	if err := e.ZeroLocus("rs2"); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := e.RecordByName("rs2"); r.ClusterScore.TotalScore != 0 || !r.ClusterScore.Edited {
+		t.Errorf("after ZeroLocus() record = %+v", r)
+	}
+	if err := e.ResetLocus("rs2"); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := e.RecordByName("rs2"); r.ClusterScore.TotalScore != 0.8 {
+		t.Errorf("after ResetLocus() record = %+v", r)
+	}
+
+	ops := []EditOp{EditMove, EditMove, EditReset, EditReset, EditZero, EditReset}
+	log := e.EditLog()
+	if len(log) != len(ops) {
+		t.Fatalf("EditLog() has %d edits, want %d", len(log), len(ops))
+	}
+	clusters := []Cluster{ClusterBB, ClusterAA, ClusterAA, ClusterBB, ClusterAll, ClusterAll}
+	for i, op := range ops {
+		if log[i].Op != op || log[i].Cluster != clusters[i] {
+			t.Errorf("edit %d = %s %s, want %s %s", i, log[i].Op, log[i].Cluster, op, clusters[i])
+		}
+	}
+	log[0].Locus = "changed"
+	if e.EditLog()[0].Locus != "rs1" {
+		t.Errorf("changing the slice returned by EditLog() changed the log")
+	}
+
+	if err := e.MoveCluster("missing", ClusterAA, 0, 0); err == nil {
+		t.Errorf("MoveCluster() of missing locus succeeded")
+	}
+	if err := e.MoveCluster("rs3", Cluster(5), 0, 0); err == nil {
+		t.Errorf("MoveCluster() of invalid cluster succeeded")
+	}
+
+	// Edits are written back.
+	if err := e.MoveCluster("rs3", ClusterAB, 0.45, 2.5); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteEGT(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewEGT(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := parsed.RecordByName("rs3"); r.ABClusterStats.ThetaMean != 0.45 || !r.ClusterScore.Edited {
+		t.Errorf("written record = %+v", r)
+	}
+}
+
+func TestEditEGTNaN(t *testing.T) {
+	e := testEGT(3)
+	records := e.ClusterRecords
+	for i := range records {
+		records[i].IntensityThreshold = float32(math.NaN())
+		records[i].Extra[3] = float32(math.NaN())
+	}
+	// Records held only in ClusterRecords can be edited too.
+	e = &EGT{ClusterRecords: records}
+	original, _ := e.RecordByName("rs2")
+
+	for i := 0; i < 2; i++ {
+		if err := e.ZeroLocus("rs1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(e.EditLog()); n != 1 {
+		t.Errorf("ZeroLocus() twice logged %d edits, want 1", n)
+	}
+
+	if err := e.MoveCluster("rs2", ClusterAB, 0.45, 2.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.ResetCluster("rs2", ClusterAB); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := e.RecordByName("rs2")
+	if r.ClusterScore != original.ClusterScore || r.ABClusterStats != original.ABClusterStats {
+		t.Errorf("after ResetCluster() record = %+v, want %+v", r, original)
+	}
+}
@@ -1,8 +1,6 @@
 package beadarray
 
 import (
-	"encoding/binary"
-	"fmt"
 	"io"
 )
 
@@ -14,17 +12,34 @@ type EGT struct {
 	NormalizationVersion string
 	DateCreated          string
 	ManifestName         string
-	Name2ClusterRecord   map[string]ClusterRecord
+	DataBlockVersion     int
+	OPA                  string
+	// ClusterRecords holds the records in file order and Name2ClusterRecord
+	// the same records keyed by locus name. Use SetClusterRecords to change
+	// them so that both, and the lookup indexes, stay consistent.
+	ClusterRecords     []ClusterRecord
+	Name2ClusterRecord map[string]ClusterRecord
+
+	name2index    map[string]int
+	address2index map[int]int
+	edits         []Edit
 }
 
 // ClusterRecord  ...
 type ClusterRecord struct {
+	Name               string
 	AAClusterStats     ClusterStats
 	ABClusterStats     ClusterStats
 	BBClusterStats     ClusterStats
 	IntensityThreshold float32
 	ClusterScore       ClusterScore
 	Address            int
+	// Genotype is the per-locus genotype string stored in the cluster file,
+	// usually empty.
+	Genotype string
+	// Extra holds the 14 floats that follow the intensity threshold in data
+	// block versions 8 and 9. Their meaning is not documented.
+	Extra [14]float32
 }
 
 // ClusterScore ...
@@ -45,129 +60,201 @@ type ClusterStats struct {
 }
 
 // NewEGT ...
-func NewEGT(r io.Reader) (egt *EGT, err error) {
-	egt = &EGT{}
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
-		}
-	}()
-	version := mustReadInt(r)
-	if version != 3 {
-		return nil, fmt.Errorf("Cluster file version %d not supported", version)
-	}
-	gencallVersion := mustReadString(r)
-	clusterVersion := mustReadString(r)
-	callVersion := mustReadString(r)
-	normalizationVersion := mustReadString(r)
-	dateCreated := mustReadString(r)
-	isWgt := mustReadByte(r)
-	if isWgt == 0 {
-		return nil, fmt.Errorf("Only WGT cluster file version supported")
-	}
-	manifestName := mustReadString(r)
-	dataBlockVersion := mustReadInt(r)
-	if dataBlockVersion != 8 && dataBlockVersion != 9 {
-		return nil, fmt.Errorf("Data block version in cluster file %d not supported", dataBlockVersion)
-	}
-
-	//opa
-	mustReadString(r) // file name?
-
-	numRecords := mustReadInt(r)
-	clusterRecords := make([]ClusterRecord, numRecords)
-	// won't work as there is extra data
-	// err = binary.Read(r, binary.LittleEndian, &clusterRecords)
-	// if err != nil {
-	// return nil, err
-	// }
-	for i := 0; i < numRecords; i++ {
-		record, err := readClusterRecord(r, dataBlockVersion)
-		if err != nil {
-			return nil, err
-		}
-		clusterRecords[i] = record
+func NewEGT(r io.Reader) (*EGT, error) {
+	d := newDecoder(r, "EGT")
+	version := d.readInt("Version")
+	if d.err == nil && version != egtFileVersion {
+		return nil, d.errorf("Version", "Cluster file version %d not supported", version)
+	}
+	gencallVersion := d.readString("GencallVersion")
+	clusterVersion := d.readString("ClusterVersion")
+	callVersion := d.readString("CallVersion")
+	normalizationVersion := d.readString("NormalizationVersion")
+	dateCreated := d.readString("DateCreated")
+	// The layout of non-WGT cluster files is not documented, so they are
+	// rejected rather than read as if they were WGT.
+	isWgt := d.readByte("IsWGT")
+	if d.err == nil && isWgt == 0 {
+		return nil, d.errorf("IsWGT", "non-WGT cluster files are not supported")
+	}
+	manifestName := d.readString("ManifestName")
+	dataBlockVersion := d.readInt("DataBlockVersion")
+	if d.err == nil && dataBlockVersion != 8 && dataBlockVersion != 9 {
+		return nil, d.errorf("DataBlockVersion", "Data block version in cluster file %d not supported", dataBlockVersion)
+	}
+
+	opa := d.readString("OPA")
+
+	numRecords := d.readInt("NumRecords")
+	if d.err == nil && numRecords < 0 {
+		return nil, d.errorf("NumRecords", "invalid number of records %d", numRecords)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	// The record count has not been validated yet, so grow the slice as
+	// records are read rather than trusting it for the allocation. Once
+	// all records have been read the count is known to be genuine.
+	clusterRecords := make([]ClusterRecord, 0, capHint(numRecords))
+	for i := 0; i < numRecords && d.err == nil; i++ {
+		d.setLocus(i, "")
+		clusterRecords = append(clusterRecords, readClusterRecord(d))
+	}
+	if d.err != nil {
+		return nil, d.err
 	}
 
 	clusterScores := make([]ClusterScore, numRecords)
 	for i := 0; i < numRecords; i++ {
-		clusterScores[i] = readClusterScore(r)
+		d.setLocus(i, "")
+		clusterScores[i] = readClusterScore(d)
 	}
-	// genotypes
 	for i := 0; i < numRecords; i++ {
-		mustReadString(r)
+		d.setLocus(i, "")
+		clusterRecords[i].Genotype = d.readString("Genotype")
 	}
-	lociNames := make([]string, numRecords)
 	for i := 0; i < numRecords; i++ {
-		lociNames[i] = mustReadString(r)
+		d.setLocus(i, "")
+		clusterRecords[i].Name = d.readString("LocusName")
 	}
 
-	addresses := make([]int32, numRecords)
-	// for i := 0; i < numRecords; i++ {
-	// 	addresses[i] = mustReadInt(r)
-	// }
-	// Is this "better"?
-	if err := binary.Read(r, binary.LittleEndian, &addresses); err != nil {
-		return egt, err
-	}
+	d.setLocus(-1, "")
+	addresses := d.readInt32s("Addresses", numRecords)
 
-	// cluster counts. In BeadArrayFiles these counts are only used to
-	// assert they are equal to the Ns in the cluster records.
+	// Cluster counts. As in BeadArrayFiles these are only checked against
+	// the Ns in the cluster records.
 	for i := 0; i < numRecords; i++ {
-		mustReadInt(r) // AA
-		mustReadInt(r) // AB
-		mustReadInt(r) // BB
+		record := clusterRecords[i]
+		d.setLocus(i, record.Name)
+		for _, c := range []struct {
+			field string
+			n     int
+		}{
+			{"AACount", record.AAClusterStats.N},
+			{"ABCount", record.ABClusterStats.N},
+			{"BBCount", record.BBClusterStats.N},
+		} {
+			count := d.readInt(c.field)
+			if d.err == nil && count != c.n {
+				return nil, d.errorf(c.field, "cluster count %d does not match cluster record N %d", count, c.n)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
 	}
 
 	//  Add address and cluster_score to each record.
-	name2clusterRecord := make(map[string]ClusterRecord)
 	for i := 0; i < numRecords; i++ {
-		record := clusterRecords[i]
-		record.Address = int(addresses[i])
-		record.ClusterScore = clusterScores[i]
-		name2clusterRecord[lociNames[i]] = record
-	}
-
-	egt.GencallVersion = gencallVersion
-	egt.ClusterVersion = clusterVersion
-	egt.CallVersion = callVersion
-	egt.NormalizationVersion = normalizationVersion
-	egt.DateCreated = dateCreated
-	egt.ManifestName = manifestName
-	egt.Name2ClusterRecord = name2clusterRecord
+		clusterRecords[i].Address = int(addresses[i])
+		clusterRecords[i].ClusterScore = clusterScores[i]
+	}
+
+	egt := &EGT{
+		GencallVersion:       gencallVersion,
+		ClusterVersion:       clusterVersion,
+		CallVersion:          callVersion,
+		NormalizationVersion: normalizationVersion,
+		DateCreated:          dateCreated,
+		ManifestName:         manifestName,
+		DataBlockVersion:     dataBlockVersion,
+		OPA:                  opa,
+	}
+	egt.SetClusterRecords(clusterRecords)
 	return egt, nil
 }
 
-func readClusterRecord(r io.Reader, version int) (ClusterRecord, error) {
-	record := ClusterRecord{}
-	if version != 9 {
-		return record, fmt.Errorf("unsupported cluster record version %d", version)
+// SetClusterRecords replaces the records of e with records, in order, and
+// rebuilds Name2ClusterRecord and the lookup indexes.
+func (e *EGT) SetClusterRecords(records []ClusterRecord) {
+	e.ClusterRecords = records
+	e.Name2ClusterRecord = make(map[string]ClusterRecord, len(records))
+	e.name2index = make(map[string]int, len(records))
+	e.address2index = make(map[int]int, len(records))
+	for i, record := range records {
+		e.Name2ClusterRecord[record.Name] = record
+		e.name2index[record.Name] = i
+		e.address2index[record.Address] = i
 	}
-	aaN := mustReadInt(r)
-	abN := mustReadInt(r)
-	bbN := mustReadInt(r)
-	ys := make([]float32, 13)
-	if err := binary.Read(r, binary.LittleEndian, &ys); err != nil {
-		return record, err
-	}
-	// aaRDev := mustReadFloat32(r)
-	// abRDev := mustReadFloat32(r)
-	// bbRDev := mustReadFloat32(r)
-	// aaRMean := mustReadFloat32(r)
-	// abRMean := mustReadFloat32(r)
-	// bbRMean := mustReadFloat32(r)
-	// aaThetaDev := mustReadFloat32(r)
-	// abThetaDev := mustReadFloat32(r)
-	// bbThetaDev := mustReadFloat32(r)
-	// aaThetaMean := mustReadFloat32(r)
-	// abThetaMean := mustReadFloat32(r)
-	// bbThetaMean := mustReadFloat32(r)
-	// intensityThreshold := mustReadFloat32(r)
-
-	// read through unused fields
-	for i := 0; i < 14; i++ {
-		mustReadFloat32(r)
+}
+
+// Len returns the number of cluster records.
+func (e *EGT) Len() int {
+	return len(e.ClusterRecords)
+}
+
+// RecordIndex returns the index in ClusterRecords of the record for the
+// named locus.
+func (e *EGT) RecordIndex(name string) (int, bool) {
+	if e.name2index == nil {
+		for i, record := range e.ClusterRecords {
+			if record.Name == name {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	i, ok := e.name2index[name]
+	return i, ok
+}
+
+// RecordByIndex returns the i'th record in file order.
+func (e *EGT) RecordByIndex(i int) (ClusterRecord, bool) {
+	if i < 0 || i >= len(e.ClusterRecords) {
+		return ClusterRecord{}, false
+	}
+	return e.ClusterRecords[i], true
+}
+
+// findRecord returns the record of the named locus from ClusterRecords or,
+// if it is not there, from Name2ClusterRecord.
+func (e *EGT) findRecord(name string) (ClusterRecord, bool) {
+	if i, ok := e.RecordIndex(name); ok {
+		return e.ClusterRecords[i], true
+	}
+	record, ok := e.Name2ClusterRecord[name]
+	return record, ok
+}
+
+// RecordByName returns the record for the named locus.
+func (e *EGT) RecordByName(name string) (ClusterRecord, bool) {
+	i, ok := e.RecordIndex(name)
+	if !ok {
+		return ClusterRecord{}, false
+	}
+	return e.ClusterRecords[i], true
+}
+
+// RecordByAddress returns the record with the given bead address.
+func (e *EGT) RecordByAddress(address int) (ClusterRecord, bool) {
+	if e.address2index == nil {
+		for _, record := range e.ClusterRecords {
+			if record.Address == address {
+				return record, true
+			}
+		}
+		return ClusterRecord{}, false
 	}
+	i, ok := e.address2index[address]
+	if !ok {
+		return ClusterRecord{}, false
+	}
+	return e.ClusterRecords[i], true
+}
+
+// readClusterRecord reads a cluster record. Data block versions 8 and 9
+// share this layout, which ends with the intensity threshold and 14
+// undocumented floats. The layout follows Illumina's BeadArrayFiles, whose
+// ClusterRecord.read_record reads it for every data block version from 7 on
+// and whose ClusterFile accepts only versions 8 and 9.
+func readClusterRecord(d *decoder) ClusterRecord {
+	aaN := d.readInt("AAClusterStats.N")
+	abN := d.readInt("ABClusterStats.N")
+	bbN := d.readInt("BBClusterStats.N")
+	ys := make([]float32, 13)
+	var extra [14]float32
+	d.readSlice("ClusterStats", ys)
+	d.readSlice("Extra", extra[:])
 	return ClusterRecord{
 		AAClusterStats: ClusterStats{
 			ThetaMean: ys[9], // aaThetaMean,
@@ -191,14 +278,15 @@ func readClusterRecord(r io.Reader, version int) (ClusterRecord, error) {
 			N:         bbN,    // bbN,
 		},
 		IntensityThreshold: ys[12], //intensityThreshold,
-	}, nil
+		Extra:              extra,
+	}
 }
 
-func readClusterScore(r io.Reader) ClusterScore {
+func readClusterScore(d *decoder) ClusterScore {
 	return ClusterScore{
-		ClusterSeparation: mustReadFloat32(r),
-		TotalScore:        mustReadFloat32(r),
-		OriginalScore:     mustReadFloat32(r),
-		Edited:            mustReadByte(r) != 0,
+		ClusterSeparation: d.readFloat32("ClusterSeparation"),
+		TotalScore:        d.readFloat32("TotalScore"),
+		OriginalScore:     d.readFloat32("OriginalScore"),
+		Edited:            d.readByte("Edited") != 0,
 	}
 }
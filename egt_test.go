@@ -3,6 +3,7 @@ package beadarray
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"log"
 	"math"
@@ -44,17 +45,18 @@ func BenchmarkReadMustReadInt(b *testing.B) {
 	}
 }
 
-func BenchmarkReadUnsafe(b *testing.B) {
+// BenchmarkReadInt32sUnsafeCast reinterprets the bytes in place, like the
+// reflect.SliceHeader cast the parsers used before decode.go, as a baseline
+// for BenchmarkReadInt32s. It casts through an array pointer since go vet
+// rejects the SliceHeader form.
+func BenchmarkReadInt32sUnsafeCast(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		r := bytes.NewReader(bb.Bytes())
 		buf := make([]byte, n*4)
 		if _, err := io.ReadAtLeast(r, buf, len(buf)); err != nil {
 			panic(err)
 		}
-		header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-		header.Len /= 4
-		header.Cap /= 4
-		_ = *(*[]int32)(unsafe.Pointer(&header))
+		_ = (*[1 << 28]int32)(unsafe.Pointer(&buf[0]))[:n:n]
 	}
 }
 
@@ -82,17 +84,16 @@ func BenchmarkReadFloat32ByteOrder(b *testing.B) {
 	}
 }
 
-func BenchmarkReadFloat32Unsafe(b *testing.B) {
+// BenchmarkReadFloat32sUnsafeCast is the baseline for BenchmarkReadFloat32s,
+// cast as in BenchmarkReadInt32sUnsafeCast.
+func BenchmarkReadFloat32sUnsafeCast(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		r := bytes.NewReader(bb.Bytes())
 		buf := make([]byte, n*4)
 		if _, err := io.ReadAtLeast(r, buf, len(buf)); err != nil {
 			panic(err)
 		}
-		header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-		header.Len /= 4
-		header.Cap /= 4
-		_ = *(*[]int32)(unsafe.Pointer(&header))
+		_ = (*[1 << 28]float32)(unsafe.Pointer(&buf[0]))[:n:n]
 	}
 }
 
@@ -119,15 +120,179 @@ func TestReadTest2(t *testing.T) {
 
 func TestReadTest3(t *testing.T) {
 	r := bytes.NewReader(bb.Bytes())
-	buf := make([]byte, n*4)
-	if _, err := io.ReadAtLeast(r, buf, len(buf)); err != nil {
+	xs := make([]int32, n)
+	if err := readInt32sInto(r, xs); err != nil {
 		panic(err)
 	}
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-	header.Len /= 4
-	header.Cap /= 4
-	xs := *(*[]int32)(unsafe.Pointer(&header))
+	for j, x := range xs {
+		if x != int32(j) {
+			t.Fatalf("xs[%d] = %v, want %v", j, x, j)
+		}
+	}
 	if len(xs) != n {
 		t.Errorf("returned array length not equal to %v, got %v", n, len(xs))
 	}
 }
+
+func TestNewEGTParseError(t *testing.T) {
+	var buf bytes.Buffer
+	writeInt(&buf, 3)
+	for _, s := range []string{"1.0", "2.0", "3.0", "4.0", "today"} {
+		writeString(&buf, s)
+	}
+	writeByte(&buf, 1)
+	writeString(&buf, "manifest.bpm")
+	writeInt(&buf, 7) // unsupported data block version
+	_, err := NewEGT(bytes.NewReader(buf.Bytes()))
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("NewEGT() error = %v, want *ParseError", err)
+	}
+	if pe.Kind != "EGT" || pe.Field != "DataBlockVersion" || pe.Offset != int64(buf.Len()-4) || pe.Locus != -1 {
+		t.Errorf("NewEGT() error = %+v", pe)
+	}
+
+	// Truncate the data block part way through the first cluster record.
+	buf.Truncate(buf.Len() - 4)
+	writeInt(&buf, 9)
+	writeString(&buf, "opa")
+	writeInt(&buf, 2)
+	writeInt(&buf, 10)
+	_, err = NewEGT(bytes.NewReader(buf.Bytes()))
+	if !errors.As(err, &pe) {
+		t.Fatalf("NewEGT() error = %v, want *ParseError", err)
+	}
+	if pe.Field != "ABClusterStats.N" || pe.Locus != 0 || !errors.Is(err, io.EOF) {
+		t.Errorf("NewEGT() error = %+v", pe)
+	}
+}
+
+func TestEGTLookups(t *testing.T) {
+	e := testEGT(5)
+	var buf bytes.Buffer
+	if err := WriteEGT(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewEGT(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A literal EGT without indexes falls back to scanning the records.
+	literal := &EGT{ClusterRecords: e.ClusterRecords}
+	for _, e := range []*EGT{parsed, literal} {
+		if e.Len() != 5 {
+			t.Errorf("Len() = %d, want 5", e.Len())
+		}
+		if i, ok := e.RecordIndex("rs3"); !ok || i != 2 {
+			t.Errorf("RecordIndex(rs3) = %d, %v; want 2", i, ok)
+		}
+		if r, ok := e.RecordByName("rs2"); !ok || r.Genotype != "AB" {
+			t.Errorf("RecordByName(rs2) = %+v, %v", r, ok)
+		}
+		if r, ok := e.RecordByAddress(10004); !ok || r.Name != "rs5" {
+			t.Errorf("RecordByAddress(10004) = %+v, %v", r, ok)
+		}
+		if r, ok := e.RecordByIndex(0); !ok || r.Name != "rs1" || r.Extra[13] != 1.5 {
+			t.Errorf("RecordByIndex(0) = %+v, %v", r, ok)
+		}
+		if _, ok := e.RecordByIndex(5); ok {
+			t.Errorf("RecordByIndex(5) succeeded")
+		}
+		if _, ok := e.RecordByName("missing"); ok {
+			t.Errorf("RecordByName(missing) succeeded")
+		}
+	}
+}
+
+func TestNewEGTClusterCountMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEGT(&buf, testEGT(3)); err != nil {
+		t.Fatal(err)
+	}
+	// The last int in the file is the BB count of the last record.
+	bs := buf.Bytes()
+	bs[len(bs)-4]++
+	_, err := NewEGT(bytes.NewReader(bs))
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Field != "BBCount" || pe.Locus != 2 || pe.LocusName != "rs3" {
+		t.Errorf("NewEGT() error = %v, want BBCount mismatch for locus 2", err)
+	}
+}
+
+func TestNewEGTNonWGT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEGT(&buf, testEGT(3)); err != nil {
+		t.Fatal(err)
+	}
+	// Clear the IsWGT byte, which follows the version and five strings.
+	bs := buf.Bytes()
+	offset := 4
+	for i := 0; i < 5; i++ {
+		offset += 1 + int(bs[offset])
+	}
+	bs[offset] = 0
+	_, err := NewEGT(bytes.NewReader(bs))
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Field != "IsWGT" {
+		t.Errorf("NewEGT() of non-WGT file error = %v, want *ParseError for IsWGT", err)
+	}
+}
+
+func TestNewEGTDataBlockVersion8(t *testing.T) {
+	// A single record laid out field by field as BeadArrayFiles reads data
+	// block version 8 (ClusterFile.py and ClusterRecord.read_record).
+	var buf bytes.Buffer
+	writeInt(&buf, 3)
+	for _, s := range []string{"7.0.0", "1.0.0", "7.0.0", "1.1.0", "1/2/2018 2:00 PM"} {
+		writeString(&buf, s)
+	}
+	buf.WriteByte(1)
+	writeString(&buf, "manifest.bpm")
+	writeInt(&buf, 8)
+	writeString(&buf, "")
+	writeInt(&buf, 1)
+	for _, n := range []int{10, 20, 5} {
+		writeInt(&buf, n)
+	}
+	// AA, AB and BB RDev, then RMean, ThetaDev and ThetaMean, then the
+	// intensity threshold.
+	for _, x := range []float32{0.1, 0.2, 0.3, 1.1, 1.2, 1.3, 0.01, 0.02, 0.03, 0.05, 0.5, 0.95, 0.25} {
+		writeFloat32(&buf, x)
+	}
+	for i := 0; i < 14; i++ {
+		writeFloat32(&buf, float32(i))
+	}
+	for _, x := range []float32{0.9, 0.8, 0.7} {
+		writeFloat32(&buf, x)
+	}
+	buf.WriteByte(1)
+	writeString(&buf, "AB")
+	writeString(&buf, "rs1")
+	writeInt(&buf, 10000)
+	for _, n := range []int{10, 20, 5} {
+		writeInt(&buf, n)
+	}
+
+	e, err := NewEGT(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extra [14]float32
+	for i := range extra {
+		extra[i] = float32(i)
+	}
+	want := ClusterRecord{
+		Name:               "rs1",
+		AAClusterStats:     ClusterStats{ThetaMean: 0.05, ThetaDev: 0.01, RMean: 1.1, RDev: 0.1, N: 10},
+		ABClusterStats:     ClusterStats{ThetaMean: 0.5, ThetaDev: 0.02, RMean: 1.2, RDev: 0.2, N: 20},
+		BBClusterStats:     ClusterStats{ThetaMean: 0.95, ThetaDev: 0.03, RMean: 1.3, RDev: 0.3, N: 5},
+		IntensityThreshold: 0.25,
+		ClusterScore:       ClusterScore{ClusterSeparation: 0.9, TotalScore: 0.8, OriginalScore: 0.7, Edited: true},
+		Address:            10000,
+		Genotype:           "AB",
+		Extra:              extra,
+	}
+	if e.DataBlockVersion != 8 || len(e.ClusterRecords) != 1 || !reflect.DeepEqual(e.ClusterRecords[0], want) {
+		t.Errorf("NewEGT() = %+v, want data block version 8 with %+v", e, want)
+	}
+}
@@ -0,0 +1,161 @@
+package beadarray
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DiffOptions sets the smallest changes reported by DiffEGT.
+type DiffOptions struct {
+	// MeanThreshold is the smallest change in a cluster's ThetaMean or
+	// RMean that is reported.
+	MeanThreshold float32
+	// DevThreshold is the smallest change in a cluster's ThetaDev or RDev
+	// that is reported.
+	DevThreshold float32
+}
+
+// EGTDiff describes the differences between two cluster files.
+type EGTDiff struct {
+	Header  []FieldChange
+	Added   []string // loci only in the second file, in its order
+	Removed []string // loci only in the first file, in its order
+	Changed []LocusChange
+}
+
+// FieldChange is a field whose value differs between two cluster files.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// LocusChange lists the fields of a locus that differ between two cluster
+// files. Cluster fields are named like "AA.ThetaMean".
+type LocusChange struct {
+	Locus  string
+	Fields []FieldChange
+}
+
+// DiffEGT compares the cluster file from with its replacement to. Loci are
+// matched by name. Changes in Edited and IntensityThreshold are always
+// reported; changes in cluster means and deviations only if at least the
+// thresholds in opts.
+func DiffEGT(from, to *EGT, opts DiffOptions) EGTDiff {
+	var d EGTDiff
+	for _, f := range []struct {
+		field, from, to string
+	}{
+		{"GencallVersion", from.GencallVersion, to.GencallVersion},
+		{"ClusterVersion", from.ClusterVersion, to.ClusterVersion},
+		{"CallVersion", from.CallVersion, to.CallVersion},
+		{"NormalizationVersion", from.NormalizationVersion, to.NormalizationVersion},
+		{"ManifestName", from.ManifestName, to.ManifestName},
+		{"DataBlockVersion", strconv.Itoa(from.DataBlockVersion), strconv.Itoa(to.DataBlockVersion)},
+	} {
+		if f.from != f.to {
+			d.Header = append(d.Header, FieldChange{f.field, f.from, f.to})
+		}
+	}
+
+	for _, o := range orderedClusterRecords(from) {
+		n, ok := to.Name2ClusterRecord[o.Name]
+		if !ok {
+			d.Removed = append(d.Removed, o.Name)
+			continue
+		}
+		if fields := diffClusterRecord(o, n, opts); len(fields) > 0 {
+			d.Changed = append(d.Changed, LocusChange{Locus: o.Name, Fields: fields})
+		}
+	}
+	for _, n := range orderedClusterRecords(to) {
+		if _, ok := from.Name2ClusterRecord[n.Name]; !ok {
+			d.Added = append(d.Added, n.Name)
+		}
+	}
+	return d
+}
+
+// orderedClusterRecords returns the records of e in file order, or by name
+// if e has no ClusterRecords.
+func orderedClusterRecords(e *EGT) []ClusterRecord {
+	if len(e.ClusterRecords) == 0 && len(e.Name2ClusterRecord) > 0 {
+		return sortedClusterRecords(e.Name2ClusterRecord)
+	}
+	return e.ClusterRecords
+}
+
+func diffClusterRecord(o, n ClusterRecord, opts DiffOptions) []FieldChange {
+	var fields []FieldChange
+	float := func(field string, x, y, threshold float32) {
+		if floatChanged(x, y, threshold) {
+			fields = append(fields, FieldChange{field, formatFloat32(x), formatFloat32(y)})
+		}
+	}
+	for _, c := range []Cluster{ClusterAA, ClusterAB, ClusterBB} {
+		a, _ := c.stats(&o)
+		b, _ := c.stats(&n)
+		prefix := c.String() + "."
+		float(prefix+"ThetaMean", a.ThetaMean, b.ThetaMean, opts.MeanThreshold)
+		float(prefix+"RMean", a.RMean, b.RMean, opts.MeanThreshold)
+		float(prefix+"ThetaDev", a.ThetaDev, b.ThetaDev, opts.DevThreshold)
+		float(prefix+"RDev", a.RDev, b.RDev, opts.DevThreshold)
+	}
+	float("IntensityThreshold", o.IntensityThreshold, n.IntensityThreshold, 0)
+	if o.ClusterScore.Edited != n.ClusterScore.Edited {
+		fields = append(fields, FieldChange{"Edited", strconv.FormatBool(o.ClusterScore.Edited), strconv.FormatBool(n.ClusterScore.Edited)})
+	}
+	return fields
+}
+
+// floatChanged reports whether x and y differ by at least threshold, or by
+// anything if threshold is zero. NaN equals only NaN.
+func floatChanged(x, y, threshold float32) bool {
+	if isNaN(x) || isNaN(y) {
+		return isNaN(x) != isNaN(y)
+	}
+	delta := math.Abs(float64(x - y))
+	if threshold == 0 {
+		return delta > 0
+	}
+	return delta >= float64(threshold)
+}
+
+func formatFloat32(x float32) string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 32)
+}
+
+// Empty reports whether the two cluster files compared the same.
+func (d EGTDiff) Empty() bool {
+	return len(d.Header) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// WriteTSV writes d to w as tab separated values with the columns Change,
+// Locus, Field, Old and New. Change is one of "header", "added", "removed"
+// or "changed", with one "changed" row per field.
+func (d EGTDiff) WriteTSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	row := func(cols ...string) {
+		bw.WriteString(strings.Join(cols, "\t"))
+		bw.WriteByte('\n')
+	}
+	row("Change", "Locus", "Field", "Old", "New")
+	for _, f := range d.Header {
+		row("header", "", f.Field, f.Old, f.New)
+	}
+	for _, name := range d.Removed {
+		row("removed", name, "", "", "")
+	}
+	for _, name := range d.Added {
+		row("added", name, "", "", "")
+	}
+	for _, c := range d.Changed {
+		for _, f := range c.Fields {
+			row("changed", c.Locus, f.Field, f.Old, f.New)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,53 @@
+package beadarray
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiffEGT(t *testing.T) {
+	from := testEGT(4)
+	to := testEGT(5)
+	to.GencallVersion = "7.1.0"
+	records := to.ClusterRecords[1:]
+	records[0].AAClusterStats.ThetaMean += 0.05 // rs2, reported
+	records[1].ABClusterStats.RDev += 0.001     // rs3, below threshold
+	records[1].ClusterScore.Edited = false      // rs3, reported
+	records[2].IntensityThreshold = 0.25        // rs4, reported
+	to.SetClusterRecords(records)
+
+	d := DiffEGT(from, to, DiffOptions{MeanThreshold: 0.01, DevThreshold: 0.01})
+	want := EGTDiff{
+		Header:  []FieldChange{{"GencallVersion", "7.0.0", "7.1.0"}},
+		Added:   []string{"rs5"},
+		Removed: []string{"rs1"},
+		Changed: []LocusChange{
+			{"rs2", []FieldChange{{"AA.ThetaMean", "0.1", "0.15"}}},
+			{"rs3", []FieldChange{{"Edited", "true", "false"}}},
+			{"rs4", []FieldChange{{"IntensityThreshold", "0.2", "0.25"}}},
+		},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("DiffEGT() = %+v, want %+v", d, want)
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteTSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wantTSV := "Change\tLocus\tField\tOld\tNew\n" +
+		"header\t\tGencallVersion\t7.0.0\t7.1.0\n" +
+		"removed\trs1\t\t\t\n" +
+		"added\trs5\t\t\t\n" +
+		"changed\trs2\tAA.ThetaMean\t0.1\t0.15\n" +
+		"changed\trs3\tEdited\ttrue\tfalse\n" +
+		"changed\trs4\tIntensityThreshold\t0.2\t0.25\n"
+	if buf.String() != wantTSV {
+		t.Errorf("WriteTSV() = %q, want %q", buf.String(), wantTSV)
+	}
+
+	if d := DiffEGT(from, testEGT(4), DiffOptions{}); !d.Empty() {
+		t.Errorf("DiffEGT() of identical files = %+v", d)
+	}
+}
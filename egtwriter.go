@@ -0,0 +1,114 @@
+package beadarray
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// egtFileVersion is the only cluster file version read and written.
+const egtFileVersion = 3
+
+// egtDataBlockVersion is the data block version written by default.
+const egtDataBlockVersion = 9
+
+// WriteEGT writes e to w as a version 3 WGT cluster file with data block
+// version e.DataBlockVersion (8 or 9), or 9 if that is zero. Records are
+// written in the order of e.ClusterRecords or, if that is empty, in order of
+// locus name from e.Name2ClusterRecord.
+func WriteEGT(w io.Writer, e *EGT) error {
+	dataBlockVersion := e.DataBlockVersion
+	if dataBlockVersion == 0 {
+		dataBlockVersion = egtDataBlockVersion
+	}
+	if dataBlockVersion != 8 && dataBlockVersion != 9 {
+		return fmt.Errorf("Data block version in cluster file %d not supported", dataBlockVersion)
+	}
+	records := e.ClusterRecords
+	if len(records) == 0 && len(e.Name2ClusterRecord) > 0 {
+		records = sortedClusterRecords(e.Name2ClusterRecord)
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := &encoder{w: bw}
+	enc.writeInt(egtFileVersion)
+	enc.writeString(e.GencallVersion)
+	enc.writeString(e.ClusterVersion)
+	enc.writeString(e.CallVersion)
+	enc.writeString(e.NormalizationVersion)
+	enc.writeString(e.DateCreated)
+	enc.writeByte(1) // IsWGT
+	enc.writeString(e.ManifestName)
+	enc.writeInt(dataBlockVersion)
+	enc.writeString(e.OPA)
+	enc.writeInt(len(records))
+	for _, record := range records {
+		writeClusterRecord(enc, record)
+	}
+	for _, record := range records {
+		writeClusterScore(enc, record.ClusterScore)
+	}
+	for _, record := range records {
+		enc.writeString(record.Genotype)
+	}
+	for _, record := range records {
+		enc.writeString(record.Name)
+	}
+	for _, record := range records {
+		enc.writeInt(record.Address)
+	}
+	for _, record := range records {
+		enc.writeInt(record.AAClusterStats.N)
+		enc.writeInt(record.ABClusterStats.N)
+		enc.writeInt(record.BBClusterStats.N)
+	}
+	if enc.err != nil {
+		return enc.err
+	}
+	return bw.Flush()
+}
+
+// writeClusterRecord writes record in the layout of data block versions 8
+// and 9 read by readClusterRecord.
+func writeClusterRecord(enc *encoder, record ClusterRecord) {
+	aa, ab, bb := record.AAClusterStats, record.ABClusterStats, record.BBClusterStats
+	enc.writeInt(aa.N)
+	enc.writeInt(ab.N)
+	enc.writeInt(bb.N)
+	enc.writeSlice([]float32{
+		aa.RDev, ab.RDev, bb.RDev,
+		aa.RMean, ab.RMean, bb.RMean,
+		aa.ThetaDev, ab.ThetaDev, bb.ThetaDev,
+		aa.ThetaMean, ab.ThetaMean, bb.ThetaMean,
+		record.IntensityThreshold,
+	})
+	enc.writeSlice(record.Extra[:])
+}
+
+// sortedClusterRecords returns the records of an EGT that has no
+// ClusterRecords, ordered by locus name.
+func sortedClusterRecords(name2record map[string]ClusterRecord) []ClusterRecord {
+	names := make([]string, 0, len(name2record))
+	for name := range name2record {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	records := make([]ClusterRecord, len(names))
+	for i, name := range names {
+		records[i] = name2record[name]
+		records[i].Name = name
+	}
+	return records
+}
+
+func writeClusterScore(enc *encoder, score ClusterScore) {
+	enc.writeFloat32(score.ClusterSeparation)
+	enc.writeFloat32(score.TotalScore)
+	enc.writeFloat32(score.OriginalScore)
+	edited := byte(0)
+	if score.Edited {
+		edited = 1
+	}
+	enc.writeByte(edited)
+}
@@ -0,0 +1,79 @@
+package beadarray
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testEGT(numRecords int) *EGT {
+	e := &EGT{
+		GencallVersion:       "7.0.0",
+		ClusterVersion:       "1.0.0",
+		CallVersion:          "7.0.0",
+		NormalizationVersion: "1.1.0",
+		DateCreated:          "1/2/2018 2:00 PM",
+		ManifestName:         "manifest.bpm",
+		DataBlockVersion:     9,
+		OPA:                  "",
+	}
+	b := testBPM(numRecords)
+	records := make([]ClusterRecord, numRecords)
+	for i, name := range b.Names {
+		c := testClusterRecord(10+i, i%3, 5)
+		c.Name = name
+		c.IntensityThreshold = 0.2
+		c.ClusterScore = ClusterScore{ClusterSeparation: 0.9, TotalScore: 0.8, OriginalScore: 0.7, Edited: i%2 == 0}
+		c.Address = b.LocusEntries[name].AddressA
+		c.Extra[0] = float32(i)
+		c.Extra[13] = 1.5
+		if i == 1 {
+			c.Genotype = "AB"
+		}
+		records[i] = c
+	}
+	e.SetClusterRecords(records)
+	return e
+}
+
+func TestWriteEGTRoundTrip(t *testing.T) {
+	for _, version := range []int{8, 9} {
+		want := testEGT(10)
+		want.DataBlockVersion = version
+		var buf bytes.Buffer
+		if err := WriteEGT(&buf, want); err != nil {
+			t.Fatalf("version %d: WriteEGT() error = %v", version, err)
+		}
+		got, err := NewEGT(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("version %d: NewEGT() error = %v", version, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("version %d: NewEGT() = %+v, want %+v", version, got, want)
+		}
+		var buf2 bytes.Buffer
+		if err := WriteEGT(&buf2, got); err != nil {
+			t.Fatalf("version %d: WriteEGT() error = %v", version, err)
+		}
+		if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+			t.Errorf("version %d: rewritten EGT differs from original", version)
+		}
+	}
+}
+
+func TestWriteEGTFromMap(t *testing.T) {
+	want := testEGT(3)
+	e := *want
+	e.ClusterRecords = nil
+	var buf bytes.Buffer
+	if err := WriteEGT(&buf, &e); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewEGT(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Name2ClusterRecord, want.Name2ClusterRecord) {
+		t.Errorf("NewEGT() records = %+v, want %+v", got.Name2ClusterRecord, want.Name2ClusterRecord)
+	}
+}
@@ -0,0 +1,38 @@
+package beadarray
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a failure to parse a GTC, EGT or BPM file. Use
+// errors.As to recover it from errors returned by this package.
+type ParseError struct {
+	Kind  string // "GTC", "EGT" or "BPM"
+	Field string // field being read when the error occurred
+	// Locus is the zero-based index of the locus being read, or -1 if the
+	// error is not associated with a locus.
+	Locus     int
+	LocusName string // empty if unknown
+	Offset    int64  // byte offset of the start of Field
+	Err       error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s parse error: ", e.Kind)
+	if e.Locus >= 0 {
+		fmt.Fprintf(&b, "locus %d", e.Locus)
+		if e.LocusName != "" {
+			fmt.Fprintf(&b, " (%s)", e.LocusName)
+		}
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "%s at offset %d: %v", e.Field, e.Offset, e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
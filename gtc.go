@@ -4,59 +4,167 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"os"
 	"path/filepath"
-	"reflect"
 	"strings"
-	"unsafe"
 )
 
 // GTC ...
+//
+// All accessors read from the underlying io.ReaderAt at absolute offsets, so
+// a GTC is safe for concurrent use provided its io.ReaderAt is (an *os.File
+// is).
 type GTC struct {
-	file      string
-	f         *os.File // bufio.Reader has no Seek method
-	Version   byte
-	toc       map[int16]int
-	genotypes []byte
+	file    string
+	r       io.ReaderAt
+	size    int64
+	closer  io.Closer
+	Version byte
+	toc     map[GTCField]int
 }
 
+// GTCField identifies an entry in the table of contents of a GTC file.
+type GTCField int16
+
+// GTC table of contents entries.
 const (
-	idNumSnps                 = 1
-	idPloidy                  = 2
-	idPloidyType              = 3
-	idSampleName              = 10
-	idSamplePlate             = 11
-	idSampleWell              = 12
-	idClusterFile             = 100
-	idSnpManifest             = 101
-	idImagingDate             = 200
-	idAutocallDate            = 201
-	idAutocallVersion         = 300
-	idNormalizationTransforms = 400
-	idControlsX               = 500
-	idControlsY               = 501
-	idRawX                    = 1000
-	idRawY                    = 1001
-	idGenotypes               = 1002
-	idBaseCalls               = 1003
-	idGenotypeScores          = 1004
-	idScannerData             = 1005
-	idCallRate                = 1006
-	idGender                  = 1007
-	idLogrDev                 = 1008
-	idGc10                    = 1009
-	idGc50                    = 1011
-	idBAlleleFreqs            = 1012
-	idLogrRatios              = 1013
-	idPercentilesX            = 1014
-	idPercentilesY            = 1015
-	idSlideIdentifier         = 1016
+	FieldNumSNPs                 GTCField = 1
+	FieldPloidy                  GTCField = 2
+	FieldPloidyType              GTCField = 3
+	FieldSampleName              GTCField = 10
+	FieldSamplePlate             GTCField = 11
+	FieldSampleWell              GTCField = 12
+	FieldClusterFile             GTCField = 100
+	FieldSnpManifest             GTCField = 101
+	FieldImagingDate             GTCField = 200
+	FieldAutocallDate            GTCField = 201
+	FieldAutocallVersion         GTCField = 300
+	FieldNormalizationTransforms GTCField = 400
+	FieldControlsX               GTCField = 500
+	FieldControlsY               GTCField = 501
+	FieldRawX                    GTCField = 1000
+	FieldRawY                    GTCField = 1001
+	FieldGenotypes               GTCField = 1002
+	FieldBaseCalls               GTCField = 1003
+	FieldGenotypeScores          GTCField = 1004
+	FieldScannerData             GTCField = 1005
+	FieldCallRate                GTCField = 1006
+	FieldGender                  GTCField = 1007
+	FieldLogRDev                 GTCField = 1008
+	FieldGC10                    GTCField = 1009
+	FieldGC50                    GTCField = 1011
+	FieldBAlleleFreqs            GTCField = 1012
+	FieldLogRRatios              GTCField = 1013
+	FieldPercentilesX            GTCField = 1014
+	FieldPercentilesY            GTCField = 1015
+	FieldSlideIdentifier         GTCField = 1016
 )
 
+var gtcFieldNames = map[GTCField]string{
+	FieldNumSNPs:                 "NumSNPs",
+	FieldPloidy:                  "Ploidy",
+	FieldPloidyType:              "PloidyType",
+	FieldSampleName:              "SampleName",
+	FieldSamplePlate:             "SamplePlate",
+	FieldSampleWell:              "SampleWell",
+	FieldClusterFile:             "ClusterFile",
+	FieldSnpManifest:             "SnpManifest",
+	FieldImagingDate:             "ImagingDate",
+	FieldAutocallDate:            "AutocallDate",
+	FieldAutocallVersion:         "AutocallVersion",
+	FieldNormalizationTransforms: "NormalizationTransforms",
+	FieldControlsX:               "ControlsX",
+	FieldControlsY:               "ControlsY",
+	FieldRawX:                    "RawX",
+	FieldRawY:                    "RawY",
+	FieldGenotypes:               "Genotypes",
+	FieldBaseCalls:               "BaseCalls",
+	FieldGenotypeScores:          "GenotypeScores",
+	FieldScannerData:             "ScannerData",
+	FieldCallRate:                "CallRate",
+	FieldGender:                  "Gender",
+	FieldLogRDev:                 "LogRDev",
+	FieldGC10:                    "GC10",
+	FieldGC50:                    "GC50",
+	FieldBAlleleFreqs:            "BAlleleFreqs",
+	FieldLogRRatios:              "LogRRatios",
+	FieldPercentilesX:            "PercentilesX",
+	FieldPercentilesY:            "PercentilesY",
+	FieldSlideIdentifier:         "SlideIdentifier",
+}
+
+func (f GTCField) String() string {
+	if name, ok := gtcFieldNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("GTCField(%d)", int16(f))
+}
+
+// GTCFields returns the TOC entries expected in a GTC file of the given
+// version, in ascending order.
+func GTCFields(version byte) []GTCField {
+	fields := []GTCField{
+		FieldNumSNPs,
+		FieldPloidy,
+		FieldPloidyType,
+		FieldSampleName,
+		FieldSamplePlate,
+		FieldSampleWell,
+		FieldClusterFile,
+		FieldSnpManifest,
+		FieldImagingDate,
+		FieldAutocallDate,
+		FieldAutocallVersion,
+		FieldNormalizationTransforms,
+		FieldControlsX,
+		FieldControlsY,
+		FieldRawX,
+		FieldRawY,
+		FieldGenotypes,
+		FieldBaseCalls,
+		FieldGenotypeScores,
+		FieldScannerData,
+		FieldCallRate,
+		FieldGender,
+		FieldLogRDev,
+		FieldGC10,
+		FieldGC50,
+	}
+	if version >= 4 {
+		fields = append(fields, FieldBAlleleFreqs, FieldLogRRatios, FieldPercentilesX, FieldPercentilesY)
+	}
+	if version >= 5 {
+		fields = append(fields, FieldSlideIdentifier)
+	}
+	return fields
+}
+
+// ErrFieldNotPresent is returned (wrapped in a *FieldNotPresentError) when a
+// GTC accessor is called for a field that is absent from the file's table
+// of contents.
+var ErrFieldNotPresent = errors.New("field not present in GTC")
+
+// FieldNotPresentError reports that Field is absent from a GTC file. It
+// matches ErrFieldNotPresent with errors.Is.
+type FieldNotPresentError struct {
+	Field   GTCField
+	Version byte
+}
+
+func (e *FieldNotPresentError) Error() string {
+	return fmt.Sprintf("%s not present in GTC file version %d", e.Field, e.Version)
+}
+
+// Is reports whether target is ErrFieldNotPresent.
+func (e *FieldNotPresentError) Is(target error) bool {
+	return target == ErrFieldNotPresent
+}
+
 var code2genotype = []string{
 	"NC",
 	"AA",
@@ -130,48 +238,71 @@ func IsGTCFile(file string) (bool, error) {
 	return contentType == "application/octet-stream" && n > 3 && string(bs[:3]) == "gtc", nil
 }
 
-// NewGTC ...
+// NewGTC opens the GTC file at path. The returned GTC should be closed with
+// Close when no longer required.
 func NewGTC(file string) (GTC, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return GTC{}, err
 	}
-
-	identifier, err := readNextBytes(f, 3)
+	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return GTC{}, err
 	}
-	if string(identifier) != "gtc" {
-		return GTC{}, fmt.Errorf("GTC format error: bad format identifier")
-	}
-	version, err := readByte(f)
+	g, err := NewGTCFromReaderAt(f, fi.Size())
 	if err != nil {
+		f.Close()
 		return GTC{}, err
 	}
-	if !isSupportedVersion(version) {
-		return GTC{}, fmt.Errorf("Unsupported GTF file version (%v)", version)
-	}
+	g.file = file
+	g.closer = f
+	return g, nil
+}
 
-	n, err := readInt(f)
+// NewGTCFromReaderAt reads a GTC from r, which must hold size bytes of GTC
+// data. This allows GTCs held in memory (e.g. a bytes.Reader) or inside
+// archives to be parsed without writing them to disk.
+func NewGTCFromReaderAt(r io.ReaderAt, size int64) (GTC, error) {
+	version, toc, err := readGTCHeader(bufio.NewReader(io.NewSectionReader(r, 0, size)))
 	if err != nil {
 		return GTC{}, err
 	}
+	return GTC{r: r, size: size, Version: version, toc: toc}, nil
+}
 
-	toc := make(map[int16]int)
+// readGTCHeader reads the format identifier, version and table of contents
+// from the start of a GTC file.
+func readGTCHeader(f io.Reader) (byte, map[GTCField]int, error) {
+	d := newDecoder(f, "GTC")
+	identifier := d.readBytes("Identifier", 3)
+	if d.err == nil && string(identifier) != "gtc" {
+		return 0, nil, d.errorf("Identifier", "GTC format error: bad format identifier")
+	}
+	version := d.readByte("Version")
+	if d.err == nil && !isSupportedVersion(version) {
+		return 0, nil, d.errorf("Version", "Unsupported GTF file version (%v)", version)
+	}
 
-	for i := 0; i < n; i++ {
-		id, err := readInt16(f)
-		if err != nil {
-			return GTC{}, err
-		}
-		offset, err := readInt(f)
-		if err != nil {
-			return GTC{}, err
-		}
-		toc[id] = offset
+	n := d.readInt("TOCEntries")
+
+	toc := make(map[GTCField]int)
+
+	for i := 0; i < n && d.err == nil; i++ {
+		id := d.readInt16("TOC")
+		offset := d.readInt("TOC")
+		toc[GTCField(id)] = offset
+	}
+	if d.err != nil {
+		return 0, nil, d.err
 	}
+	return version, toc, nil
+}
 
-	return GTC{file: file, f: f, Version: version, toc: toc}, nil
+// Has reports whether field is present in the GTC's table of contents.
+func (g GTC) Has(field GTCField) bool {
+	_, ok := g.toc[field]
+	return ok
 }
 
 // Filename ...
@@ -181,46 +312,46 @@ func (g GTC) Filename() string {
 
 // CallRate ...
 func (g GTC) CallRate() (float32, error) {
-	return g.genericFloat(idCallRate)
+	return g.genericFloat(FieldCallRate)
 }
 
 // LogRDev ...
 func (g GTC) LogRDev() (float32, error) {
-	return g.genericFloat(idLogrDev)
+	return g.genericFloat(FieldLogRDev)
 }
 
 // GC10 returns the GC10 (GenCall score - 10th percentile).
 func (g GTC) GC10() (float32, error) {
-	return g.genericFloat(idGc10)
+	return g.genericFloat(FieldGC10)
 }
 
 // GC50 returns the GC50 (GenCall score - 50th percentile).
 func (g GTC) GC50() (float32, error) {
-	return g.genericFloat(idGc50)
+	return g.genericFloat(FieldGC50)
 }
 
 // NumCalls returns the number of calls.
 func (g GTC) NumCalls() (int, error) {
-	return g.genericInt(g.toc[idGc50] + 4)
+	return g.genericInt(FieldGC50, 4)
 }
 
 // NumNoCalls ...
 func (g GTC) NumNoCalls() (int, error) {
-	return g.genericInt(g.toc[idGc50] + 8)
+	return g.genericInt(FieldGC50, 8)
 }
 
 // NumIntensityOnly returns the number of intensity only SNPs
 func (g GTC) NumIntensityOnly() (int, error) {
-	return g.genericInt(g.toc[idGc50] + 12)
+	return g.genericInt(FieldGC50, 12)
 }
 
 // SampleName ...
 func (g GTC) SampleName() (string, error) {
-	name, err := g.genericString(g.toc[idSampleName])
+	name, err := g.genericString(FieldSampleName)
 	if err != nil {
 		return "", err
 	}
-	if name == "" {
+	if name == "" && g.file != "" {
 		return strings.TrimSuffix(filepath.Base(g.file), ".gtc"), nil
 	}
 	return name, nil
@@ -228,96 +359,73 @@ func (g GTC) SampleName() (string, error) {
 
 // ClusterFile ...
 func (g GTC) ClusterFile() (string, error) {
-	return g.genericString(g.toc[idClusterFile])
+	return g.genericString(FieldClusterFile)
 }
 
 // SlideIdentifier ...
 func (g GTC) SlideIdentifier() (string, error) {
-	return g.genericString(g.toc[idSlideIdentifier])
+	return g.genericString(FieldSlideIdentifier)
 }
 
 // SamplePlate ...
 func (g GTC) SamplePlate() (string, error) {
-	return g.genericString(g.toc[idSamplePlate])
+	return g.genericString(FieldSamplePlate)
 }
 
 // SampleWell ...
 func (g GTC) SampleWell() (string, error) {
-	return g.genericString(g.toc[idSampleWell])
+	return g.genericString(FieldSampleWell)
 }
 
 // SnpManifest ...
 func (g GTC) SnpManifest() (string, error) {
-	return g.genericString(g.toc[idSnpManifest])
+	return g.genericString(FieldSnpManifest)
 }
 
 // ImagingDate ...
 func (g GTC) ImagingDate() (string, error) {
-	return g.genericString(g.toc[idImagingDate])
+	return g.genericString(FieldImagingDate)
 }
 
 // AutocallDate ...
 func (g GTC) AutocallDate() (string, error) {
-	return g.genericString(g.toc[idAutocallDate])
+	return g.genericString(FieldAutocallDate)
 }
 
 // AutocallVersion ...
 func (g GTC) AutocallVersion() (string, error) {
-	return g.genericString(g.toc[idAutocallVersion])
+	return g.genericString(FieldAutocallVersion)
 }
 
 // Gender ...
 func (g GTC) Gender() (string, error) {
-	pos := g.toc[idGender]
-	_, err := g.f.Seek(int64(pos), io.SeekStart)
+	b, err := g.gotoPosition(FieldGender)
 	if err != nil {
-		return "", err
+		return "", g.wrap(FieldGender, err)
 	}
-	r, err := readByte(g.f)
+	r, err := readByte(b)
 	if err != nil {
-		return "", err
+		return "", g.wrap(FieldGender, err)
 	}
 	return string(r), nil
 }
 
 // Genotypes ...
-func (g *GTC) Genotypes() ([]byte, error) {
-	if g.genotypes != nil {
-		// Just return cached result if available
-		return g.genotypes, nil
-	}
-
-	// f, err := os.Open(gtc.file)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// defer f.Close()
-	pos := g.toc[idGenotypes]
-	_, err := g.f.Seek(int64(pos), io.SeekStart)
+func (g GTC) Genotypes() ([]byte, error) {
+	b, numEntries, err := g.arrayReader(FieldGenotypes, 1)
 	if err != nil {
 		return nil, err
 	}
-	b := bufio.NewReader(g.f)
-	numEntries, err := readInt(b)
+	r, err := readNextBytes(b, numEntries)
 	if err != nil {
-		return nil, err
-	}
-	r := make([]byte, numEntries)
-	for i := 0; i < numEntries; i++ {
-		x, err := readByte(b)
-		if err != nil {
-			return nil, err
-		}
-		r[i] = x
+		return nil, g.wrap(FieldGenotypes, err)
 	}
-	// Cache result
-	g.genotypes = r
 	return r, nil
 }
 
 // PloidyType ...
 func (g GTC) PloidyType() int {
-	return g.toc[idPloidyType]
+	return g.toc[FieldPloidyType]
 }
 
 // BaseCalls ...
@@ -327,35 +435,28 @@ func (g GTC) BaseCalls() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	// f, err := os.Open(gtc.file)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// defer f.Close()
-	pos := int64(g.toc[idBaseCalls])
-	_, err = g.f.Seek(pos, io.SeekStart)
+	rawBaseCalls, err := g.rawBaseCalls()
 	if err != nil {
 		return nil, err
 	}
-	b := bufio.NewReader(g.f)
-	numEntries, err := readInt(b)
-	if err != nil {
-		return nil, err
-	}
-	r := make([]string, numEntries)
-	for i := 0; i < numEntries; i++ {
-		if ploidyType == 1 {
-			bytes, err := readNextBytes(b, 2)
-			if err != nil {
-				return nil, err
+	if len(genotypes) != len(rawBaseCalls) {
+		return nil, g.wrap(FieldBaseCalls, fmt.Errorf("%d base calls but %d genotypes", len(rawBaseCalls), len(genotypes)))
+	}
+	r := make([]string, len(rawBaseCalls))
+	for i, bytes := range rawBaseCalls {
+		if int(genotypes[i]) >= len(code2genotype) {
+			return nil, &ParseError{
+				Kind:   "GTC",
+				Field:  FieldGenotypes.String(),
+				Locus:  i,
+				Offset: int64(g.toc[FieldGenotypes]) + 4 + int64(i),
+				Err:    fmt.Errorf("invalid genotype code %d", genotypes[i]),
 			}
-			r[i] = string(bytes)
+		}
+		if ploidyType == 1 {
+			r[i] = string(bytes[:])
 		} else {
-			bytes, err := readNextBytes(b, 2)
-			if err != nil {
-				return nil, err
-			}
-			byteString := string(bytes)
+			byteString := string(bytes[:])
 			abGenotype := code2genotype[genotypes[i]]
 			if abGenotype == "NC" || abGenotype == "NULL" {
 				r[i] = "-"
@@ -376,25 +477,40 @@ func (g GTC) BaseCalls() ([]string, error) {
 	return r, nil
 }
 
-// Close ...
+// rawBaseCalls returns the A and B allele bases of each SNP as stored in the
+// file.
+func (g GTC) rawBaseCalls() ([][2]byte, error) {
+	b, numEntries, err := g.arrayReader(FieldBaseCalls, 2)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := readNextBytes(b, numEntries*2)
+	if err != nil {
+		return nil, g.wrap(FieldBaseCalls, err)
+	}
+	r := make([][2]byte, numEntries)
+	for i := range r {
+		copy(r[i][:], buf[i*2:])
+	}
+	return r, nil
+}
+
+// Close closes the underlying file if the GTC was opened with NewGTC. It is
+// a no-op for GTCs created with NewGTCFromReaderAt.
 func (g GTC) Close() {
-	g.f.Close()
+	if g.closer != nil {
+		g.closer.Close()
+	}
 }
 
 // BAlleleFreqs ...
 func (g GTC) BAlleleFreqs() ([]float32, error) {
-	if g.Version < 4 {
-		return nil, fmt.Errorf("B allele frequencies unavailable in GTC File version %v", g.Version)
-	}
-	return g.genericFloat32Slice(idBAlleleFreqs)
+	return g.genericFloat32Slice(FieldBAlleleFreqs)
 }
 
 // LogRRatios ...
 func (g GTC) LogRRatios() ([]float32, error) {
-	if g.Version < 4 {
-		return nil, fmt.Errorf("LogR ratios unavailable in GTC File version %v", g.Version)
-	}
-	return g.genericFloat32Slice(idLogrRatios)
+	return g.genericFloat32Slice(FieldLogRRatios)
 }
 
 // NormalizationTransform ...
@@ -451,6 +567,12 @@ func readNormalizationTransform(r io.Reader) (NormalizationTransform, error) {
 
 // RectToPolar ...
 func (nt NormalizationTransform) RectToPolar(x, y float32) (float64, float64) {
+	return rectToPolar(x, y)
+}
+
+// rectToPolar converts normalized intensities to R and Theta. Both are NaN
+// if x and y are zero or either is NaN.
+func rectToPolar(x, y float32) (float64, float64) {
 	if x == 0 && y == 0 {
 		return math.NaN(), math.NaN()
 	}
@@ -489,27 +611,43 @@ func (nt NormalizationTransform) NormalizeIntensities(x, y float32, threshold bo
 
 // NormalizationTransforms ...
 func (g GTC) NormalizationTransforms() ([]NormalizationTransform, error) {
+	b, numEntries, err := g.arrayReader(FieldNormalizationTransforms, 52)
+	if err != nil {
+		return nil, err
+	}
+	r, err := readNormalizationTransformBlocks(b, numEntries)
+	if err != nil {
+		return nil, g.wrap(FieldNormalizationTransforms, err)
+	}
+	return r, nil
+}
+
+func readNormalizationTransforms(b io.Reader) ([]NormalizationTransform, error) {
+	numEntries, err := readInt(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCount(numEntries, false, 0); err != nil {
+		return nil, err
+	}
+	return readNormalizationTransformBlocks(b, numEntries)
+}
+
+func readNormalizationTransformBlocks(b io.Reader, numEntries int) ([]NormalizationTransform, error) {
 	// The components of a NormalizationTransform do not sum to 52 bytes,
 	// but they are in 52 byte blocks. Must read in 52 bytes then extract
 	// from that. I don't know what, if anything, is in the remaining bytes.
-	pos := g.toc[idNormalizationTransforms]
-	_, err := g.f.Seek(int64(pos), io.SeekStart)
-	if err != nil {
-		return nil, fmt.Errorf("GTC.NormalizationTransforms failed: %w", err)
-	}
-	b := bufio.NewReader(g.f)
-	numEntries, _ := readInt(b)
-	r := make([]NormalizationTransform, numEntries)
+	r := make([]NormalizationTransform, 0, capHint(numEntries))
 	for i := 0; i < numEntries; i++ {
 		buf, err := readNextBytes(b, 52)
 		if err != nil {
-			return nil, fmt.Errorf("GTC.NormalizationTransforms failed: %w", err)
+			return nil, err
 		}
 		nt, err := readNormalizationTransform(bytes.NewReader(buf))
 		if err != nil {
-			return nil, fmt.Errorf("GTC.NormalizationTransforms failed: %w", err)
+			return nil, err
 		}
-		r[i] = nt
+		r = append(r, nt)
 	}
 	return r, nil
 }
@@ -521,7 +659,16 @@ func (g GTC) NormalizedIntensities(normalizationLookups []byte) ([]float32, []fl
 		return nil, nil, err
 	}
 	rawX, err := g.RawXIntensities()
+	if err != nil {
+		return nil, nil, err
+	}
 	rawY, err := g.RawYIntensities()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rawX) != len(rawY) || len(rawX) != len(normalizationLookups) {
+		return nil, nil, fmt.Errorf("have %d raw X, %d raw Y intensities and %d normalization lookups", len(rawX), len(rawY), len(normalizationLookups))
+	}
 
 	xs := make([]float32, len(rawX))
 	ys := make([]float32, len(rawY))
@@ -529,6 +676,9 @@ func (g GTC) NormalizedIntensities(normalizationLookups []byte) ([]float32, []fl
 		x := rawX[i]
 		y := rawY[i]
 		lookup := normalizationLookups[i]
+		if int(lookup) >= len(normalizationTransforms) {
+			return nil, nil, fmt.Errorf("normalization lookup %d for SNP %d out of range, GTC has %d transforms", lookup, i, len(normalizationTransforms))
+		}
 		// nt := normalizationTransforms[lookup]
 		nx, ny := normalizationTransforms[lookup].NormalizeIntensities(float32(x), float32(y), true)
 		xs[i] = nx
@@ -538,29 +688,67 @@ func (g GTC) NormalizedIntensities(normalizationLookups []byte) ([]float32, []fl
 	return xs, ys, nil
 }
 
+// NormalizedIntensitiesForManifest returns the normalized intensities of g
+// using the normalization lookups of b, which must be the manifest g was
+// called against. It returns an error if g does not have one normalization
+// transform per distinct normalization ID in b.
+func (g GTC) NormalizedIntensitiesForManifest(b BPM) ([]float32, []float32, error) {
+	lookups, numTransforms, err := b.normalizationLookups()
+	if err != nil {
+		return nil, nil, err
+	}
+	transforms, err := g.NormalizationTransforms()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(transforms) != numTransforms {
+		return nil, nil, fmt.Errorf("GTC has %d normalization transforms but manifest %s has %d normalization IDs", len(transforms), b.ManifestName, numTransforms)
+	}
+	return g.NormalizedIntensities(lookups)
+}
+
+// PolarIntensities returns the normalized R and Theta of every SNP in g,
+// using the normalization lookups of b. R and Theta are NaN for SNPs whose
+// normalized intensities are both zero, which includes SNPs with no raw
+// intensity.
+func (g GTC) PolarIntensities(b BPM) ([]float32, []float32, error) {
+	xs, ys, err := g.NormalizedIntensitiesForManifest(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs := make([]float32, len(xs))
+	thetas := make([]float32, len(xs))
+	for i := range xs {
+		r, theta := rectToPolar(xs[i], ys[i])
+		rs[i] = float32(r)
+		thetas[i] = float32(theta)
+	}
+	return rs, thetas, nil
+}
+
 // GenotypeScores returns the genotype scores.
 func (g GTC) GenotypeScores() ([]float32, error) {
-	return g.genericFloat32Slice(idGenotypeScores)
+	return g.genericFloat32Slice(FieldGenotypeScores)
 }
 
 // ControlXIntensities returns the x intensities of control bead types.
 func (g GTC) ControlXIntensities() ([]uint16, error) {
-	return g.genericUint16Slice(idControlsX)
+	return g.genericUint16Slice(FieldControlsX)
 }
 
 // ControlYIntensities returns the y intensities of control bead types.
 func (g GTC) ControlYIntensities() ([]uint16, error) {
-	return g.genericUint16Slice(idControlsY)
+	return g.genericUint16Slice(FieldControlsY)
 }
 
 // RawXIntensities returns the raw x intensities of assay bead types.
 func (g GTC) RawXIntensities() ([]int16, error) {
-	return g.genericInt16Slice(idRawX)
+	return g.genericInt16Slice(FieldRawX)
 }
 
 // RawYIntensities returns the raw y intensities of assay bead types.
 func (g GTC) RawYIntensities() ([]int16, error) {
-	return g.genericInt16Slice(idRawY)
+	return g.genericInt16Slice(FieldRawY)
 }
 
 // ScannerData ...
@@ -572,138 +760,210 @@ type ScannerData struct {
 	User     string
 }
 
-func readScannerData(r io.Reader) ScannerData {
+func readScannerData(r io.Reader) (ScannerData, error) {
 	ret := ScannerData{}
-	ret.Name = mustReadString(r)
-	ret.PmtGreen = mustReadInt(r)
-	ret.PmtRed = mustReadInt(r)
-	ret.Version = mustReadString(r)
-	ret.User = mustReadString(r)
-	return ret
+	var err error
+	if ret.Name, err = readString(r); err != nil {
+		return ret, err
+	}
+	if ret.PmtGreen, err = readInt(r); err != nil {
+		return ret, err
+	}
+	if ret.PmtRed, err = readInt(r); err != nil {
+		return ret, err
+	}
+	if ret.Version, err = readString(r); err != nil {
+		return ret, err
+	}
+	if ret.User, err = readString(r); err != nil {
+		return ret, err
+	}
+	return ret, nil
 }
 
 // ScannerData returns information about scanner
+//
+// Deprecated: ScannerData returns an empty ScannerData if the field is
+// absent or cannot be parsed. Use Scanner, which reports the error.
 func (g GTC) ScannerData() ScannerData {
-	pos := g.toc[idScannerData]
-	_, _ = g.f.Seek(int64(pos), io.SeekStart)
-	b := bufio.NewReader(g.f)
-	return readScannerData(b)
+	sd, _ := g.Scanner()
+	return sd
+}
+
+// Scanner returns information about the scanner. A *FieldNotPresentError is
+// returned if the GTC has no scanner data and a *ParseError if it cannot be
+// read.
+func (g GTC) Scanner() (ScannerData, error) {
+	b, err := g.gotoPosition(FieldScannerData)
+	if err != nil {
+		return ScannerData{}, g.wrap(FieldScannerData, err)
+	}
+	sd, err := readScannerData(b)
+	if err != nil {
+		return ScannerData{}, g.wrap(FieldScannerData, err)
+	}
+	return sd, nil
 }
 
 // PercentilesX returns a slice of length three representing 5th, 50th and 95th percentile for x intensity.
 func (g GTC) PercentilesX() ([]uint16, error) {
-	return g.genericUint16Slice(idPercentilesX)
+	return g.percentiles(FieldPercentilesX)
 }
 
 // PercentileY returns a slice of length three representing 5th, 50th and 95th percentile for y intensity.
 func (g GTC) PercentileY() ([]uint16, error) {
-	return g.genericUint16Slice(idPercentilesY)
+	return g.percentiles(FieldPercentilesY)
 }
 
-func (g GTC) gotoPosition(tocEntry int16) (io.Reader, error) {
-	pos := int64(g.toc[tocEntry])
-	_, err := g.f.Seek(pos, io.SeekStart)
+// percentiles reads the three uint16 values stored for a percentile entry.
+// Unlike the other arrays in a GTC these are not preceded by a count.
+func (g GTC) percentiles(tocEntry GTCField) ([]uint16, error) {
+	b, err := g.gotoPosition(tocEntry)
 	if err != nil {
-		return nil, err
+		return nil, g.wrap(tocEntry, err)
 	}
-	b := bufio.NewReader(g.f)
-	return b, nil
+	r := make([]uint16, 3)
+	for i := range r {
+		if r[i], err = readUint16(b); err != nil {
+			return nil, g.wrap(tocEntry, err)
+		}
+	}
+	return r, nil
+}
+
+// reader returns a buffered reader positioned at pos. Every call returns an
+// independent reader so accessors never share a file position.
+func (g GTC) reader(pos int64) io.Reader {
+	return bufio.NewReader(io.NewSectionReader(g.r, pos, g.size-pos))
+}
+
+// gotoPosition returns a reader positioned at the start of tocEntry. A
+// *FieldNotPresentError is returned if the entry is absent from the TOC.
+func (g GTC) gotoPosition(tocEntry GTCField) (io.Reader, error) {
+	offset, ok := g.toc[tocEntry]
+	if !ok {
+		return nil, &FieldNotPresentError{Field: tocEntry, Version: g.Version}
+	}
+	pos := int64(offset)
+	if pos < 0 || pos > g.size {
+		return nil, g.wrap(tocEntry, fmt.Errorf("offset %d out of range", pos))
+	}
+	return g.reader(pos), nil
 }
 
-func (g GTC) genericString(tocEntry int) (string, error) {
-	_, err := g.f.Seek(int64(tocEntry), io.SeekStart)
+// wrap converts an error from reading tocEntry into a *ParseError. Errors
+// that are already a *ParseError or *FieldNotPresentError are returned
+// unchanged.
+func (g GTC) wrap(tocEntry GTCField, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *ParseError
+	var fe *FieldNotPresentError
+	if errors.As(err, &pe) || errors.As(err, &fe) {
+		return err
+	}
+	return gtcParseError(tocEntry, g.toc[tocEntry], err)
+}
+
+func (g GTC) genericString(tocEntry GTCField) (string, error) {
+	b, err := g.gotoPosition(tocEntry)
 	if err != nil {
-		return "", err
+		return "", g.wrap(tocEntry, err)
 	}
-	return readString(g.f)
+	str, err := readString(b)
+	return str, g.wrap(tocEntry, err)
 }
 
-func (g GTC) genericInt(pos int) (int, error) {
-	_, err := g.f.Seek(int64(pos), io.SeekStart)
+// genericInt reads an int skip bytes past the start of tocEntry.
+func (g GTC) genericInt(tocEntry GTCField, skip int) (int, error) {
+	b, err := g.gotoPosition(tocEntry)
 	if err != nil {
-		return 0, err
+		return 0, g.wrap(tocEntry, err)
 	}
-	return readInt(g.f)
+	if _, err := readNextBytes(b, skip); err != nil {
+		return 0, g.wrap(tocEntry, err)
+	}
+	n, err := readInt(b)
+	return n, g.wrap(tocEntry, err)
 }
 
-func (g GTC) genericFloat(tocEntry int16) (float32, error) {
+func (g GTC) genericFloat(tocEntry GTCField) (float32, error) {
 	b, err := g.gotoPosition(tocEntry)
 	if err != nil {
-		return 0.0, err
+		return 0.0, g.wrap(tocEntry, err)
 	}
 	var r float32
 	err = binary.Read(b, binary.LittleEndian, &r)
-	return r, err
+	return r, g.wrap(tocEntry, err)
 }
 
-func (g *GTC) genericInt16Slice(tocEntry int16) ([]int16, error) {
+// arrayReader returns a reader positioned after the entry count of the array
+// stored at tocEntry, together with that count. The count is checked against
+// the bytes remaining in the file and, for per-SNP arrays, against NumSNPs
+// before the caller allocates anything.
+func (g GTC) arrayReader(tocEntry GTCField, elemSize int) (io.Reader, int, error) {
 	b, err := g.gotoPosition(tocEntry)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	var numEntries int32
-	if err := binary.Read(b, binary.LittleEndian, &numEntries); err != nil {
-		return nil, err
+	n, err := readInt(b)
+	if err != nil {
+		return nil, 0, g.wrap(tocEntry, err)
 	}
-	buf := make([]byte, int(numEntries)*2)
-	if _, err := io.ReadAtLeast(b, buf, len(buf)); err != nil {
-		return nil, err
+	numSNPs, hasNumSNPs := g.toc[FieldNumSNPs]
+	if err := checkCount(n, hasNumSNPs && isPerSNP(tocEntry), numSNPs); err != nil {
+		return nil, 0, g.wrap(tocEntry, err)
 	}
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-	header.Len /= 2
-	header.Cap /= 2
-	xs := *(*[]int16)(unsafe.Pointer(&header))
-	return xs, nil
+	remaining := g.size - int64(g.toc[tocEntry]) - 4
+	if int64(n)*int64(elemSize) > remaining {
+		return nil, 0, g.wrap(tocEntry, fmt.Errorf("%d entries of %d bytes exceed the %d bytes remaining in file", n, elemSize, remaining))
+	}
+	return b, n, nil
 }
 
-func (g *GTC) genericUint16Slice(tocEntry int16) ([]uint16, error) {
-	b, err := g.gotoPosition(tocEntry)
-	if err != nil {
-		return nil, err
+// isPerSNP reports whether tocEntry is an array with one entry per SNP.
+func isPerSNP(tocEntry GTCField) bool {
+	switch tocEntry {
+	case FieldRawX, FieldRawY, FieldGenotypes, FieldBaseCalls, FieldGenotypeScores, FieldBAlleleFreqs, FieldLogRRatios:
+		return true
 	}
-	var numEntries int32
-	if err := binary.Read(b, binary.LittleEndian, &numEntries); err != nil {
+	return false
+}
+
+func (g GTC) genericInt16Slice(tocEntry GTCField) ([]int16, error) {
+	b, numEntries, err := g.arrayReader(tocEntry, 2)
+	if err != nil {
 		return nil, err
 	}
-	buf := make([]byte, int(numEntries)*2)
-	if _, err := io.ReadAtLeast(b, buf, len(buf)); err != nil {
-		return nil, err
+	xs := make([]int16, numEntries)
+	if err := readInt16sInto(b, xs); err != nil {
+		return nil, g.wrap(tocEntry, err)
 	}
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-	header.Len /= 2
-	header.Cap /= 2
-	xs := *(*[]uint16)(unsafe.Pointer(&header))
 	return xs, nil
 }
 
-func (g *GTC) genericFloat32Slice(tocEntry int16) ([]float32, error) {
-	b, err := g.gotoPosition(tocEntry)
+func (g GTC) genericUint16Slice(tocEntry GTCField) ([]uint16, error) {
+	b, numEntries, err := g.arrayReader(tocEntry, 2)
 	if err != nil {
 		return nil, err
 	}
-	var numEntries int32
-	if err := binary.Read(b, binary.LittleEndian, &numEntries); err != nil {
-		return nil, err
+	xs := make([]uint16, numEntries)
+	if err := readUint16sInto(b, xs); err != nil {
+		return nil, g.wrap(tocEntry, err)
 	}
-	buf := make([]byte, int(numEntries)*4)
-	if _, err := io.ReadAtLeast(b, buf, len(buf)); err != nil {
+	return xs, nil
+}
+
+func (g GTC) genericFloat32Slice(tocEntry GTCField) ([]float32, error) {
+	b, numEntries, err := g.arrayReader(tocEntry, 4)
+	if err != nil {
 		return nil, err
 	}
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-	header.Len /= 4
-	header.Cap /= 4
-	xs := *(*[]float32)(unsafe.Pointer(&header))
-
-	// math.Float32frombits uses unsafe anyway so why would this approach be
-	// "better" or "safer"?
-	// xs := make([]float32, numEntries)
-	// for i := 0; i < int(numEntries); i++ {
-	// 	start := i * 4
-	// 	end := start + 4
-	// 	x := math.Float32frombits(binary.LittleEndian.Uint32(buf[start:end]))
-	// 	xs[i] = x
-	// }
-
+	xs := make([]float32, numEntries)
+	if err := readFloat32sInto(b, xs); err != nil {
+		return nil, g.wrap(tocEntry, err)
+	}
 	return xs, nil
 }
 
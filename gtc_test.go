@@ -3,12 +3,13 @@ package beadarray
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"log"
 	"math"
 	"reflect"
+	"sync"
 	"testing"
-	"unsafe"
 )
 
 var nFloats = 730059
@@ -44,14 +45,11 @@ func readFloat32Slice2(r io.Reader, n int) []float32 {
 }
 
 func readFloat32Slice3(r io.Reader, n int) []float32 {
-	buf := make([]byte, int(n)*4)
-	if _, err := io.ReadAtLeast(r, buf, len(buf)); err != nil {
+	xs := make([]float32, n)
+	if err := readFloat32sInto(r, xs); err != nil {
 		log.Fatal(err)
 	}
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&buf))
-	header.Len /= 4
-	header.Cap /= 4
-	return *(*[]float32)(unsafe.Pointer(&header))
+	return xs
 }
 func setup() ([]byte, []float32) {
 	bs := []byte{}
@@ -151,3 +149,296 @@ func Test_readFloat32Slice3(t *testing.T) {
 		})
 	}
 }
+
+// minimalGTC returns a version 3 GTC holding only NumSNPs, SampleName and
+// RawX, laid out by hand.
+func minimalGTC() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("gtc")
+	buf.WriteByte(3)
+	binary.Write(&buf, binary.LittleEndian, int32(3))
+	headerSize := 3 + 1 + 4 + 3*6
+	sampleName := headerSize
+	rawX := sampleName + 1 + len("sample1")
+	for _, e := range []struct {
+		id     GTCField
+		offset int32
+	}{{FieldNumSNPs, 2}, {FieldSampleName, int32(sampleName)}, {FieldRawX, int32(rawX)}} {
+		binary.Write(&buf, binary.LittleEndian, int16(e.id))
+		binary.Write(&buf, binary.LittleEndian, e.offset)
+	}
+	buf.WriteByte(byte(len("sample1")))
+	buf.WriteString("sample1")
+	binary.Write(&buf, binary.LittleEndian, []int32{2})
+	binary.Write(&buf, binary.LittleEndian, []int16{5, -7})
+	return buf.Bytes()
+}
+
+func TestNewGTCFromReaderAt(t *testing.T) {
+	bs := minimalGTC()
+	g, err := NewGTCFromReaderAt(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reading fields out of file order must work as each accessor seeks to
+	// its own offset.
+	xs, err := g.RawXIntensities()
+	if err != nil || !reflect.DeepEqual(xs, []int16{5, -7}) {
+		t.Errorf("RawXIntensities() = %v, %v; want [5 -7]", xs, err)
+	}
+	if name, err := g.SampleName(); err != nil || name != "sample1" {
+		t.Errorf("SampleName() = %q, %v; want sample1", name, err)
+	}
+	if xs, err := g.RawXIntensities(); err != nil || len(xs) != 2 {
+		t.Errorf("second RawXIntensities() = %v, %v", xs, err)
+	}
+}
+
+func TestGTCConcurrentAccess(t *testing.T) {
+	d := testGTCData(5, 1000)
+	var buf bytes.Buffer
+	if err := WriteGTC(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				xs, err := g.RawXIntensities()
+				if err != nil || !reflect.DeepEqual(xs, d.RawX) {
+					t.Errorf("RawXIntensities() = %v, %v", len(xs), err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				name, err := g.SampleName()
+				if err != nil || name != d.SampleName {
+					t.Errorf("SampleName() = %q, %v", name, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGTCMissingField(t *testing.T) {
+	for _, version := range []byte{3, 4, 5} {
+		var buf bytes.Buffer
+		if err := WriteGTC(&buf, testGTCData(version, 10)); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range GTCFields(version) {
+			if !g.Has(field) {
+				t.Errorf("version %d: Has(%s) = false, want true", version, field)
+			}
+		}
+		_, err = g.SlideIdentifier()
+		if got, want := g.Has(FieldSlideIdentifier), version >= 5; got != want {
+			t.Errorf("version %d: Has(FieldSlideIdentifier) = %v, want %v", version, got, want)
+		}
+		if version < 5 {
+			var e *FieldNotPresentError
+			if !errors.Is(err, ErrFieldNotPresent) || !errors.As(err, &e) || e.Field != FieldSlideIdentifier {
+				t.Errorf("version %d: SlideIdentifier() error = %v, want FieldNotPresentError", version, err)
+			}
+		} else if err != nil {
+			t.Errorf("version %d: SlideIdentifier() error = %v", version, err)
+		}
+		_, err = g.BAlleleFreqs()
+		if version < 4 && !errors.Is(err, ErrFieldNotPresent) {
+			t.Errorf("version %d: BAlleleFreqs() error = %v, want ErrFieldNotPresent", version, err)
+		}
+	}
+}
+
+func TestGTCParseError(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGTC(&buf, testGTCData(5, 10)); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cut the file off half way through the raw intensities.
+	size := int64(g.toc[FieldRawX] + 4 + 10)
+	g, err = NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()[:size]), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.RawXIntensities()
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("RawXIntensities() error = %v, want *ParseError", err)
+	}
+	if pe.Kind != "GTC" || pe.Field != "RawX" || pe.Offset != int64(g.toc[FieldRawX]) {
+		t.Errorf("RawXIntensities() error = %+v", pe)
+	}
+}
+
+func TestGTCCorruptCounts(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGTC(&buf, testGTCData(5, 10)); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		field GTCField
+		count uint32
+		read  func(GTC) error
+	}{
+		{"huge", FieldRawX, 0x7FFFFFFF, func(g GTC) error { _, err := g.RawXIntensities(); return err }},
+		{"negative", FieldGenotypeScores, 0xFFFFFFFF, func(g GTC) error { _, err := g.GenotypeScores(); return err }},
+		{"not NumSNPs", FieldGenotypes, 9, func(g GTC) error { _, err := g.Genotypes(); return err }},
+		{"controls", FieldControlsX, 0x10000000, func(g GTC) error { _, err := g.ControlXIntensities(); return err }},
+		{"transforms", FieldNormalizationTransforms, 0x10000000, func(g GTC) error { _, err := g.NormalizationTransforms(); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs := append([]byte(nil), buf.Bytes()...)
+			binary.LittleEndian.PutUint32(bs[g.toc[tt.field]:], tt.count)
+			corrupt, err := NewGTCFromReaderAt(bytes.NewReader(bs), int64(len(bs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pe *ParseError
+			if err := tt.read(corrupt); !errors.As(err, &pe) || pe.Field != tt.field.String() {
+				t.Errorf("accessor error = %v, want *ParseError for %s", err, tt.field)
+			}
+			if _, err := ReadGTCData(bytes.NewReader(bs)); !errors.As(err, &pe) || pe.Field != tt.field.String() {
+				t.Errorf("ReadGTCData() error = %v, want *ParseError for %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestReadStringCorruptLength(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", []byte{0xFF, 0xFF, 0xFF, 0x7F, 'a', 'b'}},
+		{"overlong prefix", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readString(bytes.NewReader(tt.data)); err == nil {
+				t.Errorf("readString() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestGTCScanner(t *testing.T) {
+	d := testGTCData(5, 10)
+	var buf bytes.Buffer
+	if err := WriteGTC(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd, err := g.Scanner(); err != nil || sd != d.ScannerData {
+		t.Errorf("Scanner() = %+v, %v; want %+v", sd, err, d.ScannerData)
+	}
+
+	// Cut the file off inside the scanner name.
+	size := int64(g.toc[FieldScannerData] + 2)
+	truncated, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()[:size]), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pe *ParseError
+	if _, err := truncated.Scanner(); !errors.As(err, &pe) || pe.Field != "ScannerData" {
+		t.Errorf("truncated Scanner() error = %v, want *ParseError", err)
+	}
+
+	bs := minimalGTC()
+	minimal, err := NewGTCFromReaderAt(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := minimal.Scanner(); !errors.Is(err, ErrFieldNotPresent) {
+		t.Errorf("Scanner() without scanner data error = %v, want ErrFieldNotPresent", err)
+	}
+}
+
+func TestGTCStringParseError(t *testing.T) {
+	bs := minimalGTC()
+	// Cut the file off inside the sample name.
+	size := int64(len(bs) - 8 - 3)
+	g, err := NewGTCFromReaderAt(bytes.NewReader(bs[:size]), size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pe *ParseError
+	if _, err := g.SampleName(); !errors.As(err, &pe) || pe.Field != "SampleName" {
+		t.Errorf("SampleName() error = %v, want *ParseError", err)
+	}
+}
+
+func TestNormalizedIntensitiesForManifest(t *testing.T) {
+	d := testGTCData(5, 10)
+	g := testGTC(t, d)
+	xs, ys, err := g.NormalizedIntensitiesForManifest(testBPM(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range xs {
+		nx, ny := d.NormalizationTransforms[i%2].NormalizeIntensities(float32(d.RawX[i]), float32(d.RawY[i]), true)
+		if xs[i] != nx || ys[i] != ny {
+			t.Errorf("SNP %d: normalized = (%v, %v), want (%v, %v)", i, xs[i], ys[i], nx, ny)
+		}
+	}
+
+	// Every locus has the same normalization ID, so the manifest expects a
+	// single transform but the GTC has two.
+	b := testBPM(10)
+	for i := range b.NormalizationIDs {
+		b.NormalizationIDs[i] = 0
+	}
+	if _, _, err := g.NormalizedIntensitiesForManifest(b); err == nil {
+		t.Errorf("NormalizedIntensitiesForManifest() with mismatched transform count succeeded, want error")
+	}
+}
+
+func TestPolarIntensities(t *testing.T) {
+	d := testGTCData(5, 10)
+	d.RawX[3], d.RawY[3] = 0, 0
+	rs, thetas, err := testGTC(t, d).PolarIntensities(testBPM(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rs {
+		nx, ny := d.NormalizationTransforms[i%2].NormalizeIntensities(float32(d.RawX[i]), float32(d.RawY[i]), true)
+		r, theta := rectToPolar(nx, ny)
+		if i == 3 {
+			if !math.IsNaN(float64(rs[i])) || !math.IsNaN(float64(thetas[i])) {
+				t.Errorf("SNP 3 with zero intensities: R, Theta = %v, %v; want NaN", rs[i], thetas[i])
+			}
+			continue
+		}
+		if rs[i] != float32(r) || thetas[i] != float32(theta) {
+			t.Errorf("SNP %d: R, Theta = %v, %v; want %v, %v", i, rs[i], thetas[i], r, theta)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package beadarray
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// GTCData holds every field of a GTC file in decoded form. It is returned by
+// ReadGTCData and GTC.Data and is the input to WriteGTC.
+type GTCData struct {
+	Version                 byte
+	NumSNPs                 int
+	Ploidy                  int
+	PloidyType              int
+	SampleName              string
+	SamplePlate             string
+	SampleWell              string
+	ClusterFile             string
+	SnpManifest             string
+	ImagingDate             string
+	AutocallDate            string
+	AutocallVersion         string
+	NormalizationTransforms []NormalizationTransform
+	ControlsX               []uint16
+	ControlsY               []uint16
+	RawX                    []int16
+	RawY                    []int16
+	Genotypes               []byte
+	// BaseCalls holds the A and B allele bases of each SNP as stored in
+	// the file; see GTC.BaseCalls for genotype-specific calls.
+	BaseCalls        [][2]byte
+	GenotypeScores   []float32
+	ScannerData      ScannerData
+	CallRate         float32
+	Gender           byte
+	LogRDev          float32
+	GC10             float32
+	GC50             float32
+	NumCalls         int
+	NumNoCalls       int
+	NumIntensityOnly int
+	BAlleleFreqs     []float32
+	LogRRatios       []float32
+	PercentilesX     []uint16
+	PercentilesY     []uint16
+	SlideIdentifier  string
+}
+
+// Data decodes every field present in the GTC in a single sequential pass.
+func (g GTC) Data() (GTCData, error) {
+	return ReadGTCData(io.NewSectionReader(g.r, 0, g.size))
+}
+
+// ReadGTCData decodes a complete GTC file from r. The TOC entries are visited
+// in file order so r is read once from start to finish and never seeks,
+// which makes it suitable for streams such as network responses or
+// compressed files.
+func ReadGTCData(r io.Reader) (GTCData, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	version, toc, err := readGTCHeader(cr)
+	if err != nil {
+		return GTCData{}, err
+	}
+	if _, ok := toc[FieldNumSNPs]; !ok {
+		return GTCData{}, &FieldNotPresentError{Field: FieldNumSNPs, Version: version}
+	}
+	d := GTCData{
+		Version:    version,
+		NumSNPs:    toc[FieldNumSNPs],
+		Ploidy:     toc[FieldPloidy],
+		PloidyType: toc[FieldPloidyType],
+	}
+
+	type entry struct {
+		id     GTCField
+		offset int
+	}
+	var entries []entry
+	for id, offset := range toc {
+		switch id {
+		case FieldNumSNPs, FieldPloidy, FieldPloidyType:
+			// Values stored directly in the TOC.
+			continue
+		}
+		entries = append(entries, entry{id, offset})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].offset < entries[j].offset })
+
+	for _, e := range entries {
+		skip := int64(e.offset) - cr.n
+		if skip < 0 {
+			return d, gtcParseError(e.id, e.offset, fmt.Errorf("entry overlaps previous entry"))
+		}
+		if _, err := io.CopyN(ioutil.Discard, cr, skip); err != nil {
+			return d, gtcParseError(e.id, e.offset, err)
+		}
+		if err := d.readEntry(cr, e.id); err != nil {
+			return d, gtcParseError(e.id, e.offset, err)
+		}
+	}
+	return d, nil
+}
+
+func gtcParseError(id GTCField, offset int, err error) error {
+	return &ParseError{Kind: "GTC", Field: id.String(), Locus: -1, Offset: int64(offset), Err: err}
+}
+
+// readEntry decodes the TOC entry id from r into d. Unknown entries are
+// ignored.
+func (d *GTCData) readEntry(r io.Reader, id GTCField) error {
+	var err error
+	switch id {
+	case FieldSampleName:
+		d.SampleName, err = readString(r)
+	case FieldSamplePlate:
+		d.SamplePlate, err = readString(r)
+	case FieldSampleWell:
+		d.SampleWell, err = readString(r)
+	case FieldClusterFile:
+		d.ClusterFile, err = readString(r)
+	case FieldSnpManifest:
+		d.SnpManifest, err = readString(r)
+	case FieldImagingDate:
+		d.ImagingDate, err = readString(r)
+	case FieldAutocallDate:
+		d.AutocallDate, err = readString(r)
+	case FieldAutocallVersion:
+		d.AutocallVersion, err = readString(r)
+	case FieldSlideIdentifier:
+		d.SlideIdentifier, err = readString(r)
+	case FieldNormalizationTransforms:
+		d.NormalizationTransforms, err = readNormalizationTransforms(r)
+	case FieldControlsX, FieldControlsY, FieldRawX, FieldRawY, FieldGenotypes,
+		FieldBaseCalls, FieldGenotypeScores, FieldBAlleleFreqs, FieldLogRRatios:
+		var n int
+		if n, err = readInt(r); err != nil {
+			return err
+		}
+		if err = checkCount(n, isPerSNP(id), d.NumSNPs); err != nil {
+			return err
+		}
+		switch id {
+		case FieldControlsX:
+			d.ControlsX, err = readUint16s(r, n)
+		case FieldControlsY:
+			d.ControlsY, err = readUint16s(r, n)
+		case FieldRawX:
+			d.RawX, err = readInt16s(r, n)
+		case FieldRawY:
+			d.RawY, err = readInt16s(r, n)
+		case FieldGenotypes:
+			d.Genotypes, err = readNextBytes(r, n)
+		case FieldBaseCalls:
+			var b []byte
+			if b, err = readNextBytes(r, n*2); err == nil {
+				d.BaseCalls = make([][2]byte, n)
+				for i := range d.BaseCalls {
+					copy(d.BaseCalls[i][:], b[i*2:])
+				}
+			}
+		case FieldGenotypeScores:
+			d.GenotypeScores, err = readFloat32s(r, n)
+		case FieldBAlleleFreqs:
+			d.BAlleleFreqs, err = readFloat32s(r, n)
+		case FieldLogRRatios:
+			d.LogRRatios, err = readFloat32s(r, n)
+		}
+	case FieldScannerData:
+		d.ScannerData, err = readScannerData(r)
+	case FieldCallRate:
+		d.CallRate, err = readFloat32(r)
+	case FieldGender:
+		d.Gender, err = readByte(r)
+	case FieldLogRDev:
+		d.LogRDev, err = readFloat32(r)
+	case FieldGC10:
+		d.GC10, err = readFloat32(r)
+	case FieldGC50:
+		if d.GC50, err = readFloat32(r); err != nil {
+			return err
+		}
+		if d.NumCalls, err = readInt(r); err != nil {
+			return err
+		}
+		if d.NumNoCalls, err = readInt(r); err != nil {
+			return err
+		}
+		d.NumIntensityOnly, err = readInt(r)
+	case FieldPercentilesX:
+		d.PercentilesX = make([]uint16, 3)
+		err = binary.Read(r, binary.LittleEndian, d.PercentilesX)
+	case FieldPercentilesY:
+		d.PercentilesY = make([]uint16, 3)
+		err = binary.Read(r, binary.LittleEndian, d.PercentilesY)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package beadarray
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReadGTCData(t *testing.T) {
+	for _, version := range []byte{3, 4, 5} {
+		want := testGTCData(version, 25)
+		var buf bytes.Buffer
+		if err := WriteGTC(&buf, want); err != nil {
+			t.Fatal(err)
+		}
+		// Hide any Seek/ReadAt methods to ensure a single forward pass.
+		r := struct{ io.Reader }{bytes.NewReader(buf.Bytes())}
+		got, err := ReadGTCData(r)
+		if err != nil {
+			t.Fatalf("version %d: ReadGTCData() error = %v", version, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("version %d: ReadGTCData() = %+v, want %+v", version, got, want)
+		}
+
+		g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scores, err := g.GenotypeScores()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(scores, got.GenotypeScores) {
+			t.Errorf("version %d: GenotypeScores() = %v, ReadGTCData() = %v", version, scores, got.GenotypeScores)
+		}
+	}
+}
+
+func TestReadGTCDataTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGTC(&buf, testGTCData(5, 25)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadGTCData(bytes.NewReader(buf.Bytes()[:buf.Len()-10])); err == nil {
+		t.Errorf("ReadGTCData() of truncated file succeeded, want error")
+	}
+}
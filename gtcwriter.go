@@ -0,0 +1,204 @@
+package beadarray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WriteGTC writes d to w as a GTC file of version d.Version. Fields that do
+// not exist in that version (e.g. BAlleleFreqs in version 3) are not written.
+func WriteGTC(w io.Writer, d GTCData) error {
+	if !isSupportedVersion(d.Version) {
+		return fmt.Errorf("Unsupported GTC file version (%v)", d.Version)
+	}
+	if err := d.validate(); err != nil {
+		return err
+	}
+	ids := GTCFields(d.Version)
+	headerSize := 3 + 1 + 4 + len(ids)*(2+4)
+
+	var body bytes.Buffer
+	offsets := make([]int, len(ids))
+	for i, id := range ids {
+		switch id {
+		// These values are stored directly in the TOC.
+		case FieldNumSNPs:
+			offsets[i] = d.NumSNPs
+			continue
+		case FieldPloidy:
+			offsets[i] = d.Ploidy
+			continue
+		case FieldPloidyType:
+			offsets[i] = d.PloidyType
+			continue
+		}
+		offsets[i] = headerSize + body.Len()
+		if err := d.writeEntry(&body, id); err != nil {
+			return fmt.Errorf("failed to write GTC entry %s: %w", id, err)
+		}
+	}
+
+	var header bytes.Buffer
+	header.WriteString("gtc")
+	header.WriteByte(d.Version)
+	if err := writeInt(&header, len(ids)); err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if err := writeInt16(&header, int16(id)); err != nil {
+			return err
+		}
+		if err := writeInt(&header, offsets[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := header.WriteTo(w); err != nil {
+		return err
+	}
+	_, err := body.WriteTo(w)
+	return err
+}
+
+// validate checks that every per-SNP array holds NumSNPs entries.
+func (d GTCData) validate() error {
+	type length struct {
+		name string
+		n    int
+	}
+	lengths := []length{
+		{"RawX", len(d.RawX)},
+		{"RawY", len(d.RawY)},
+		{"Genotypes", len(d.Genotypes)},
+		{"BaseCalls", len(d.BaseCalls)},
+		{"GenotypeScores", len(d.GenotypeScores)},
+	}
+	if d.Version >= 4 {
+		lengths = append(lengths,
+			length{"BAlleleFreqs", len(d.BAlleleFreqs)},
+			length{"LogRRatios", len(d.LogRRatios)},
+		)
+	}
+	for _, l := range lengths {
+		if l.n != d.NumSNPs {
+			return fmt.Errorf("GTC data has %d %s, expected NumSNPs (%d)", l.n, l.name, d.NumSNPs)
+		}
+	}
+	if len(d.ControlsX) != len(d.ControlsY) {
+		return fmt.Errorf("GTC data has %d ControlsX but %d ControlsY", len(d.ControlsX), len(d.ControlsY))
+	}
+	if d.Version >= 4 && (len(d.PercentilesX) != 3 || len(d.PercentilesY) != 3) {
+		return fmt.Errorf("GTC data percentiles must have exactly three values")
+	}
+	return nil
+}
+
+func (d GTCData) writeEntry(w io.Writer, id GTCField) error {
+	switch id {
+	case FieldSampleName:
+		return writeString(w, d.SampleName)
+	case FieldSamplePlate:
+		return writeString(w, d.SamplePlate)
+	case FieldSampleWell:
+		return writeString(w, d.SampleWell)
+	case FieldClusterFile:
+		return writeString(w, d.ClusterFile)
+	case FieldSnpManifest:
+		return writeString(w, d.SnpManifest)
+	case FieldImagingDate:
+		return writeString(w, d.ImagingDate)
+	case FieldAutocallDate:
+		return writeString(w, d.AutocallDate)
+	case FieldAutocallVersion:
+		return writeString(w, d.AutocallVersion)
+	case FieldSlideIdentifier:
+		return writeString(w, d.SlideIdentifier)
+	case FieldNormalizationTransforms:
+		if err := writeInt(w, len(d.NormalizationTransforms)); err != nil {
+			return err
+		}
+		for _, nt := range d.NormalizationTransforms {
+			if err := writeNormalizationTransform(w, nt); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FieldControlsX:
+		return writeSlice(w, len(d.ControlsX), d.ControlsX)
+	case FieldControlsY:
+		return writeSlice(w, len(d.ControlsY), d.ControlsY)
+	case FieldRawX:
+		return writeSlice(w, len(d.RawX), d.RawX)
+	case FieldRawY:
+		return writeSlice(w, len(d.RawY), d.RawY)
+	case FieldGenotypes:
+		return writeSlice(w, len(d.Genotypes), d.Genotypes)
+	case FieldBaseCalls:
+		return writeSlice(w, len(d.BaseCalls), d.BaseCalls)
+	case FieldGenotypeScores:
+		return writeSlice(w, len(d.GenotypeScores), d.GenotypeScores)
+	case FieldBAlleleFreqs:
+		return writeSlice(w, len(d.BAlleleFreqs), d.BAlleleFreqs)
+	case FieldLogRRatios:
+		return writeSlice(w, len(d.LogRRatios), d.LogRRatios)
+	case FieldScannerData:
+		return writeScannerData(w, d.ScannerData)
+	case FieldCallRate:
+		return writeFloat32(w, d.CallRate)
+	case FieldGender:
+		return writeByte(w, d.Gender)
+	case FieldLogRDev:
+		return writeFloat32(w, d.LogRDev)
+	case FieldGC10:
+		return writeFloat32(w, d.GC10)
+	case FieldGC50:
+		if err := writeFloat32(w, d.GC50); err != nil {
+			return err
+		}
+		for _, x := range []int{d.NumCalls, d.NumNoCalls, d.NumIntensityOnly} {
+			if err := writeInt(w, x); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FieldPercentilesX:
+		return binary.Write(w, binary.LittleEndian, d.PercentilesX)
+	case FieldPercentilesY:
+		return binary.Write(w, binary.LittleEndian, d.PercentilesY)
+	}
+	return fmt.Errorf("unknown TOC entry %s", id)
+}
+
+// writeNormalizationTransform writes nt padded to the 52 byte block used in
+// GTC files.
+func writeNormalizationTransform(w io.Writer, nt NormalizationTransform) error {
+	var buf bytes.Buffer
+	if err := writeInt(&buf, nt.Version); err != nil {
+		return err
+	}
+	for _, x := range []float32{nt.OffsetX, nt.OffsetY, nt.ScaleX, nt.ScaleY, nt.Shear, nt.Theta} {
+		if err := writeFloat32(&buf, x); err != nil {
+			return err
+		}
+	}
+	buf.Write(make([]byte, 52-buf.Len()))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeScannerData(w io.Writer, sd ScannerData) error {
+	if err := writeString(w, sd.Name); err != nil {
+		return err
+	}
+	if err := writeInt(w, sd.PmtGreen); err != nil {
+		return err
+	}
+	if err := writeInt(w, sd.PmtRed); err != nil {
+		return err
+	}
+	if err := writeString(w, sd.Version); err != nil {
+		return err
+	}
+	return writeString(w, sd.User)
+}
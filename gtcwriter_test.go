@@ -0,0 +1,94 @@
+package beadarray
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testGTCData(version byte, numSNPs int) GTCData {
+	d := GTCData{
+		Version:         version,
+		NumSNPs:         numSNPs,
+		Ploidy:          2,
+		PloidyType:      1,
+		SampleName:      "sample1",
+		SamplePlate:     "plate1",
+		SampleWell:      "A01",
+		ClusterFile:     "cluster.egt",
+		SnpManifest:     "manifest.bpm",
+		ImagingDate:     "Monday, January 01, 2018 1:00:00 PM",
+		AutocallDate:    "1/2/2018 2:00 PM",
+		AutocallVersion: "3.0.0",
+		NormalizationTransforms: []NormalizationTransform{
+			{Version: 1, OffsetX: 10, OffsetY: 20, ScaleX: 1.5, ScaleY: 2.5, Shear: 0.1, Theta: 0.2},
+			{Version: 1, OffsetX: 11, OffsetY: 21, ScaleX: 1.6, ScaleY: 2.6, Shear: 0.3, Theta: 0.4},
+		},
+		ControlsX:        []uint16{100, 200, 300},
+		ControlsY:        []uint16{400, 500, 600},
+		ScannerData:      ScannerData{Name: "N123", PmtGreen: 1, PmtRed: 2, Version: "1.0", User: "user"},
+		CallRate:         0.99,
+		Gender:           'F',
+		LogRDev:          0.12,
+		GC10:             0.5,
+		GC50:             0.8,
+		NumCalls:         numSNPs - 1,
+		NumNoCalls:       1,
+		NumIntensityOnly: 0,
+	}
+	for i := 0; i < numSNPs; i++ {
+		d.RawX = append(d.RawX, int16(1000+i))
+		d.RawY = append(d.RawY, int16(2000+i))
+		d.Genotypes = append(d.Genotypes, byte(i%4))
+		d.BaseCalls = append(d.BaseCalls, [2]byte{'A', 'G'})
+		d.GenotypeScores = append(d.GenotypeScores, float32(i)/float32(numSNPs))
+	}
+	if version >= 4 {
+		for i := 0; i < numSNPs; i++ {
+			d.BAlleleFreqs = append(d.BAlleleFreqs, float32(i%3)/2)
+			d.LogRRatios = append(d.LogRRatios, float32(i)/10-0.5)
+		}
+		d.PercentilesX = []uint16{10, 500, 5000}
+		d.PercentilesY = []uint16{20, 600, 6000}
+	}
+	if version >= 5 {
+		d.SlideIdentifier = "201234567890"
+	}
+	return d
+}
+
+func TestWriteGTCRoundTrip(t *testing.T) {
+	for _, version := range []byte{3, 4, 5} {
+		want := testGTCData(version, 10)
+		var buf bytes.Buffer
+		if err := WriteGTC(&buf, want); err != nil {
+			t.Fatalf("version %d: WriteGTC() error = %v", version, err)
+		}
+		g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("version %d: NewGTCFromReaderAt() error = %v", version, err)
+		}
+		got, err := g.Data()
+		if err != nil {
+			t.Fatalf("version %d: Data() error = %v", version, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("version %d: Data() = %+v, want %+v", version, got, want)
+		}
+		var buf2 bytes.Buffer
+		if err := WriteGTC(&buf2, got); err != nil {
+			t.Fatalf("version %d: WriteGTC() error = %v", version, err)
+		}
+		if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+			t.Errorf("version %d: rewritten GTC differs from original", version)
+		}
+	}
+}
+
+func TestWriteGTCValidate(t *testing.T) {
+	d := testGTCData(5, 10)
+	d.RawY = d.RawY[:9]
+	if err := WriteGTC(&bytes.Buffer{}, d); err == nil {
+		t.Errorf("WriteGTC() with short RawY succeeded, want error")
+	}
+}
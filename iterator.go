@@ -0,0 +1,135 @@
+package beadarray
+
+import (
+	"fmt"
+	"math"
+)
+
+// LocusRecord holds the data for one locus of a sample together with the
+// manifest information for that locus.
+type LocusRecord struct {
+	Index   int // position of the locus in the GTC arrays and BPM.Names
+	Name    string
+	Chrom   string
+	MapInfo int
+	// Genotype is the genotype code, an index into Code2Genotype.
+	Genotype byte
+	BaseCall string
+	Score    float32
+	// BAlleleFreq and LogRRatio are NaN if the GTC does not store them
+	// (GTC version 3).
+	BAlleleFreq float32
+	LogRRatio   float32
+	RawX        int16
+	RawY        int16
+	NormX       float32
+	NormY       float32
+}
+
+// LocusIterator yields one LocusRecord per locus of a GTC, in manifest
+// order. Typical use is:
+//
+//	it, err := NewLocusIterator(gtc, bpm)
+//	if err != nil {
+//		return err
+//	}
+//	for it.Next() {
+//		rec := it.Record()
+//		...
+//	}
+type LocusIterator struct {
+	bpm       BPM
+	genotypes []byte
+	baseCalls []string
+	scores    []float32
+	bafs      []float32
+	lrrs      []float32
+	rawX      []int16
+	rawY      []int16
+	normX     []float32
+	normY     []float32
+	i         int
+}
+
+// NewLocusIterator reads the per-locus arrays of g and checks that they
+// match the loci in bpm.
+func NewLocusIterator(g GTC, bpm BPM) (*LocusIterator, error) {
+	it := &LocusIterator{bpm: bpm, i: -1}
+	var err error
+	if it.genotypes, err = g.Genotypes(); err != nil {
+		return nil, err
+	}
+	if len(it.genotypes) != len(bpm.Names) {
+		return nil, fmt.Errorf("GTC has %d SNPs but manifest has %d loci", len(it.genotypes), len(bpm.Names))
+	}
+	if it.baseCalls, err = g.BaseCalls(); err != nil {
+		return nil, err
+	}
+	if it.scores, err = g.GenotypeScores(); err != nil {
+		return nil, err
+	}
+	if g.Has(FieldBAlleleFreqs) {
+		if it.bafs, err = g.BAlleleFreqs(); err != nil {
+			return nil, err
+		}
+	}
+	if g.Has(FieldLogRRatios) {
+		if it.lrrs, err = g.LogRRatios(); err != nil {
+			return nil, err
+		}
+	}
+	if it.rawX, err = g.RawXIntensities(); err != nil {
+		return nil, err
+	}
+	if it.rawY, err = g.RawYIntensities(); err != nil {
+		return nil, err
+	}
+	if it.normX, it.normY, err = g.NormalizedIntensitiesForManifest(bpm); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// Len returns the number of loci.
+func (it *LocusIterator) Len() int {
+	return len(it.genotypes)
+}
+
+// Next advances to the next locus. It returns false when there are no more
+// loci.
+func (it *LocusIterator) Next() bool {
+	if it.i < len(it.genotypes) {
+		it.i++
+	}
+	return it.i < len(it.genotypes)
+}
+
+// Record returns the current locus. It must only be called after a call to
+// Next has returned true.
+func (it *LocusIterator) Record() LocusRecord {
+	i := it.i
+	name := it.bpm.Names[i]
+	locus, _ := it.bpm.LocusByIndex(i)
+	rec := LocusRecord{
+		Index:       i,
+		Name:        name,
+		Chrom:       locus.Chrom,
+		MapInfo:     locus.MapInfo,
+		Genotype:    it.genotypes[i],
+		BaseCall:    it.baseCalls[i],
+		Score:       it.scores[i],
+		BAlleleFreq: float32(math.NaN()),
+		LogRRatio:   float32(math.NaN()),
+		RawX:        it.rawX[i],
+		RawY:        it.rawY[i],
+		NormX:       it.normX[i],
+		NormY:       it.normY[i],
+	}
+	if it.bafs != nil {
+		rec.BAlleleFreq = it.bafs[i]
+	}
+	if it.lrrs != nil {
+		rec.LogRRatio = it.lrrs[i]
+	}
+	return rec
+}
@@ -0,0 +1,90 @@
+package beadarray
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// testBPM returns a manifest for numLoci loci split between two
+// normalization IDs.
+func testBPM(numLoci int) BPM {
+	b := BPM{
+		Version:      5,
+		VersionFlag:  true,
+		ManifestName: "manifest.bpm",
+	}
+	loci := make([]LocusEntry, numLoci)
+	for i := range loci {
+		name := fmt.Sprintf("rs%d", i+1)
+		b.NormalizationIDs = append(b.NormalizationIDs, byte(i%2))
+		loci[i] = LocusEntry{
+			Index:        i + 1,
+			LocusVersion: 8,
+			Name:         name,
+			Chrom:        "1",
+			MapInfo:      1000 * (i + 1),
+			AddressA:     10000 + i,
+		}
+	}
+	b.SetLoci(loci)
+	return b
+}
+
+func testGTC(t *testing.T, d GTCData) GTC {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteGTC(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGTCFromReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestLocusIterator(t *testing.T) {
+	for _, version := range []byte{3, 5} {
+		d := testGTCData(version, 10)
+		bpm := testBPM(10)
+		it, err := NewLocusIterator(testGTC(t, d), bpm)
+		if err != nil {
+			t.Fatalf("version %d: NewLocusIterator() error = %v", version, err)
+		}
+		n := 0
+		for it.Next() {
+			rec := it.Record()
+			i := n
+			n++
+			if rec.Index != i || rec.Name != bpm.Names[i] || rec.MapInfo != 1000*(i+1) {
+				t.Errorf("version %d: record %d = %+v", version, i, rec)
+			}
+			if rec.Genotype != d.Genotypes[i] || rec.RawX != d.RawX[i] || rec.RawY != d.RawY[i] || rec.Score != d.GenotypeScores[i] {
+				t.Errorf("version %d: record %d = %+v", version, i, rec)
+			}
+			nt := d.NormalizationTransforms[i%2]
+			nx, ny := nt.NormalizeIntensities(float32(d.RawX[i]), float32(d.RawY[i]), true)
+			if rec.NormX != nx || rec.NormY != ny {
+				t.Errorf("version %d: record %d normalized = (%v, %v), want (%v, %v)", version, i, rec.NormX, rec.NormY, nx, ny)
+			}
+			if version == 3 {
+				if !math.IsNaN(float64(rec.BAlleleFreq)) || !math.IsNaN(float64(rec.LogRRatio)) {
+					t.Errorf("version 3: record %d BAF, LRR = %v, %v; want NaN", i, rec.BAlleleFreq, rec.LogRRatio)
+				}
+			} else if rec.BAlleleFreq != d.BAlleleFreqs[i] || rec.LogRRatio != d.LogRRatios[i] {
+				t.Errorf("version %d: record %d BAF, LRR = %v, %v", version, i, rec.BAlleleFreq, rec.LogRRatio)
+			}
+		}
+		if n != 10 || it.Next() {
+			t.Errorf("version %d: iterated %d loci, want 10", version, n)
+		}
+	}
+}
+
+func TestLocusIteratorMismatch(t *testing.T) {
+	if _, err := NewLocusIterator(testGTC(t, testGTCData(5, 10)), testBPM(9)); err == nil {
+		t.Errorf("NewLocusIterator() with mismatched manifest succeeded, want error")
+	}
+}
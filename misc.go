@@ -5,9 +5,28 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
+// maxPrealloc is the largest buffer allocated up front for a length read
+// from a file. Longer reads grow their buffer as data arrives, so a corrupt
+// or malicious length cannot exhaust memory before the input runs out.
+const maxPrealloc = 1 << 20
+
 func readNextBytes(file io.Reader, number int) ([]byte, error) {
+	if number < 0 {
+		return nil, fmt.Errorf("readbytes: invalid length %v", number)
+	}
+	if number > maxPrealloc {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, file, int64(number)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf.Bytes(), err
+		}
+		return buf.Bytes(), nil
+	}
 	buf := make([]byte, number)
 	n, err := io.ReadAtLeast(file, buf, number)
 	if err != nil {
@@ -74,7 +93,7 @@ func readUint16(r io.Reader) (uint16, error) {
 		return ret, err
 	}
 	buf := bytes.NewReader(b)
-	err = binary.Read(buf, binary.LittleEndian, &r)
+	err = binary.Read(buf, binary.LittleEndian, &ret)
 	return ret, err
 }
 
@@ -92,14 +111,6 @@ func readByte(file io.Reader) (byte, error) {
 	return x, nil
 }
 
-func mustReadByte(r io.Reader) byte {
-	x, err := readByte(r)
-	if err != nil {
-		panic(err)
-	}
-	return x
-}
-
 func readString(file io.Reader) (string, error) {
 	totalLength := 0
 	bt, err := readByte(file)
@@ -109,6 +120,10 @@ func readString(file io.Reader) (string, error) {
 	partialLength := int(bt)
 	numBytes := 0
 	for partialLength&0x80 > 0 {
+		if numBytes == 4 {
+			// Five bytes is enough for any int32 length.
+			return "", fmt.Errorf("invalid string length prefix")
+		}
 		totalLength += int((partialLength & 0x7F) << (7 * numBytes))
 		b, err := readByte(file)
 		if err != nil {
@@ -129,14 +144,6 @@ func readString(file io.Reader) (string, error) {
 	return r, nil
 }
 
-func mustReadString(r io.Reader) string {
-	s, err := readString(r)
-	if err != nil {
-		panic(err)
-	}
-	return s
-}
-
 func readFloat32(file io.Reader) (float32, error) {
 	var r float32
 	b, err := readNextBytes(file, 4)
@@ -152,10 +159,257 @@ func readFloat32(file io.Reader) (float32, error) {
 
 }
 
-func mustReadFloat32(r io.Reader) float32 {
-	n, err := readFloat32(r)
-	if err != nil {
-		panic(err)
+func writeInt(w io.Writer, x int) error {
+	if x < math.MinInt32 || x > math.MaxInt32 {
+		return fmt.Errorf("writeInt: %d overflows int32", x)
+	}
+	return binary.Write(w, binary.LittleEndian, int32(x))
+}
+
+func writeInt16(w io.Writer, x int16) error {
+	return binary.Write(w, binary.LittleEndian, x)
+}
+
+func writeByte(w io.Writer, x byte) error {
+	_, err := w.Write([]byte{x})
+	return err
+}
+
+func writeFloat32(w io.Writer, x float32) error {
+	return binary.Write(w, binary.LittleEndian, x)
+}
+
+// writeString writes s preceded by its length encoded in the variable length
+// format understood by readString.
+func writeString(w io.Writer, s string) error {
+	var buf []byte
+	n := len(s)
+	for n >= 0x80 {
+		buf = append(buf, byte(n&0x7F|0x80))
+		n >>= 7
+	}
+	buf = append(buf, byte(n))
+	buf = append(buf, s...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// writeSlice writes the length of xs as an int32 followed by the elements of
+// xs, which must be a slice of a fixed size type.
+func writeSlice(w io.Writer, n int, xs interface{}) error {
+	if err := writeInt(w, n); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, xs)
+}
+
+// countingReader records the number of bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// checkCount validates an entry count read from a file. Per-SNP arrays must
+// have exactly numSNPs entries.
+func checkCount(n int, perSNP bool, numSNPs int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid entry count %d", n)
+	}
+	if perSNP && n != numSNPs {
+		return fmt.Errorf("entry count %d does not match number of SNPs (%d)", n, numSNPs)
+	}
+	return nil
+}
+
+// capHint returns a capacity to preallocate for n entries read from a file
+// whose count has not been validated.
+func capHint(n int) int {
+	const maxHint = 1 << 16
+	if n > maxHint {
+		return maxHint
 	}
 	return n
 }
+
+// decoder reads the primitive types used by Illumina's binary formats from a
+// stream. The first error encountered is recorded as a *ParseError in err and
+// all later reads return zero values, so a sequence of reads only needs to be
+// checked once.
+type decoder struct {
+	r         *countingReader
+	kind      string
+	locus     int
+	locusName string
+	last      int64 // offset of the start of the most recent read
+	err       error
+}
+
+func newDecoder(r io.Reader, kind string) *decoder {
+	return &decoder{r: &countingReader{r: r}, kind: kind, locus: -1}
+}
+
+// setLocus associates subsequent errors with the given locus.
+func (d *decoder) setLocus(index int, name string) {
+	d.locus = index
+	d.locusName = name
+}
+
+// fail records err against field unless an error has already been recorded.
+func (d *decoder) fail(field string, offset int64, err error) error {
+	if d.err == nil {
+		d.err = &ParseError{
+			Kind:      d.kind,
+			Field:     field,
+			Locus:     d.locus,
+			LocusName: d.locusName,
+			Offset:    offset,
+			Err:       err,
+		}
+	}
+	return d.err
+}
+
+// errorf records a validation error for field, which is taken to start at
+// the offset of the most recent read.
+func (d *decoder) errorf(field string, format string, args ...interface{}) error {
+	return d.fail(field, d.last, fmt.Errorf(format, args...))
+}
+
+func (d *decoder) readInt(field string) int {
+	if d.err != nil {
+		return 0
+	}
+	d.last = d.r.n
+	x, err := readInt(d.r)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return x
+}
+
+func (d *decoder) readInt16(field string) int16 {
+	if d.err != nil {
+		return 0
+	}
+	d.last = d.r.n
+	x, err := readInt16(d.r)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return x
+}
+
+func (d *decoder) readByte(field string) byte {
+	if d.err != nil {
+		return 0
+	}
+	d.last = d.r.n
+	x, err := readByte(d.r)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return x
+}
+
+func (d *decoder) readFloat32(field string) float32 {
+	if d.err != nil {
+		return 0
+	}
+	d.last = d.r.n
+	x, err := readFloat32(d.r)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return x
+}
+
+func (d *decoder) readString(field string) string {
+	if d.err != nil {
+		return ""
+	}
+	d.last = d.r.n
+	s, err := readString(d.r)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return s
+}
+
+func (d *decoder) readBytes(field string, n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	d.last = d.r.n
+	b, err := readNextBytes(d.r, n)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return b
+}
+
+// readSlice fills xs, a slice of a fixed size type, from the stream.
+func (d *decoder) readSlice(field string, xs interface{}) {
+	if d.err != nil {
+		return
+	}
+	d.last = d.r.n
+	if err := binary.Read(d.r, binary.LittleEndian, xs); err != nil {
+		d.fail(field, d.last, err)
+	}
+}
+
+func (d *decoder) readInt32s(field string, n int) []int32 {
+	if d.err != nil {
+		return nil
+	}
+	d.last = d.r.n
+	xs, err := readInt32s(d.r, n)
+	if err != nil {
+		d.fail(field, d.last, err)
+	}
+	return xs
+}
+
+// encoder writes the primitive types used by Illumina's binary formats. Like
+// decoder it records the first error in err and skips all later writes.
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) writeInt(x int) {
+	if e.err == nil {
+		e.err = writeInt(e.w, x)
+	}
+}
+
+func (e *encoder) writeByte(x byte) {
+	if e.err == nil {
+		e.err = writeByte(e.w, x)
+	}
+}
+
+func (e *encoder) writeFloat32(x float32) {
+	if e.err == nil {
+		e.err = writeFloat32(e.w, x)
+	}
+}
+
+func (e *encoder) writeString(s string) {
+	if e.err == nil {
+		e.err = writeString(e.w, s)
+	}
+}
+
+// writeSlice writes xs, a slice of fixed size values, without a count.
+func (e *encoder) writeSlice(xs interface{}) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.LittleEndian, xs)
+	}
+}
@@ -0,0 +1,222 @@
+package beadarray
+
+import (
+	"fmt"
+	"math"
+)
+
+// LocusQuality holds quality metrics for the clusters of one locus.
+type LocusQuality struct {
+	Name              string
+	ClusterSeparation float32
+	GenTrainScore     float32 // ClusterScore.TotalScore
+	// ABRRatio is the AB cluster R mean divided by the mean R of the
+	// populated homozygote clusters. It is NaN if either is missing.
+	ABRRatio    float32
+	ABRMean     float32 // NaN if there is no AB cluster
+	ABThetaMean float32 // NaN if there is no AB cluster
+	ABThetaDev  float32 // NaN if there is no AB cluster
+	// Genotype counts, from the cluster record or from sample calls.
+	NumAA, NumAB, NumBB, NumNC int
+	CallFreq                   float32
+	MinorAlleleFreq            float32
+	// HetExcess is the observed heterozygote frequency less that expected
+	// under Hardy-Weinberg equilibrium, divided by the expected frequency.
+	// It is NaN for loci with no called samples or a monomorphic locus.
+	HetExcess     float32
+	MinorHomCount int
+}
+
+// NewLocusQuality computes the quality metrics of a cluster record, taking
+// genotype counts from the cluster Ns.
+func NewLocusQuality(c ClusterRecord) LocusQuality {
+	nan := float32(math.NaN())
+	q := LocusQuality{
+		Name:              c.Name,
+		ClusterSeparation: c.ClusterScore.ClusterSeparation,
+		GenTrainScore:     c.ClusterScore.TotalScore,
+		ABRRatio:          nan,
+		ABRMean:           nan,
+		ABThetaMean:       nan,
+		ABThetaDev:        nan,
+	}
+	if c.ABClusterStats.N > 0 {
+		q.ABRMean = c.ABClusterStats.RMean
+		q.ABThetaMean = c.ABClusterStats.ThetaMean
+		q.ABThetaDev = c.ABClusterStats.ThetaDev
+		var homR float32
+		homs := 0
+		for _, s := range []ClusterStats{c.AAClusterStats, c.BBClusterStats} {
+			if s.N > 0 {
+				homR += s.RMean
+				homs++
+			}
+		}
+		if homs > 0 {
+			q.ABRRatio = q.ABRMean / (homR / float32(homs))
+		}
+	}
+	q.setCounts(c.AAClusterStats.N, c.ABClusterStats.N, c.BBClusterStats.N, 0)
+	return q
+}
+
+// setCounts sets the genotype counts and the metrics derived from them.
+func (q *LocusQuality) setCounts(aa, ab, bb, nc int) {
+	q.NumAA, q.NumAB, q.NumBB, q.NumNC = aa, ab, bb, nc
+	called := aa + ab + bb
+	nan := float32(math.NaN())
+	q.CallFreq, q.MinorAlleleFreq, q.HetExcess = nan, nan, nan
+	q.MinorHomCount = aa
+	if bb < aa {
+		q.MinorHomCount = bb
+	}
+	if called+nc > 0 {
+		q.CallFreq = float32(called) / float32(called+nc)
+	}
+	if called == 0 {
+		return
+	}
+	p := (2*float64(aa) + float64(ab)) / (2 * float64(called))
+	q.MinorAlleleFreq = float32(math.Min(p, 1-p))
+	if expected := 2 * p * (1 - p); expected > 0 {
+		observed := float64(ab) / float64(called)
+		q.HetExcess = float32((observed - expected) / expected)
+	}
+}
+
+// ClusterQuality computes the quality metrics of every record in e, in
+// record order, with genotype counts from the cluster Ns.
+func ClusterQuality(e *EGT) []LocusQuality {
+	records := orderedClusterRecords(e)
+	qs := make([]LocusQuality, len(records))
+	for i, record := range records {
+		qs[i] = NewLocusQuality(record)
+	}
+	return qs
+}
+
+// ClusterQualityFromSamples computes the quality metrics of every locus in
+// b using the clusters in e, with genotype counts from the calls stored in
+// gtcs, so that CallFreq reflects the no calls in the cohort.
+func ClusterQualityFromSamples(e *EGT, b BPM, gtcs []GTC) ([]LocusQuality, error) {
+	records, err := e.ClusterRecordsFor(b.Names)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([][4]int, len(b.Names))
+	for _, g := range gtcs {
+		genotypes, err := g.Genotypes()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", g.Filename(), err)
+		}
+		if len(genotypes) != len(b.Names) {
+			return nil, fmt.Errorf("%s: GTC has %d SNPs but manifest has %d loci", g.Filename(), len(genotypes), len(b.Names))
+		}
+		for i, code := range genotypes {
+			switch code {
+			case genotypeAA, genotypeAB, genotypeBB:
+				counts[i][code-genotypeAA]++
+			default:
+				counts[i][3]++
+			}
+		}
+	}
+	qs := make([]LocusQuality, len(records))
+	for i, record := range records {
+		qs[i] = NewLocusQuality(record)
+		qs[i].Name = b.Names[i]
+		qs[i].setCounts(counts[i][0], counts[i][1], counts[i][2], counts[i][3])
+	}
+	return qs, nil
+}
+
+// FilterRules are thresholds for excluding loci, modelled on the SNP
+// filtering rules Illumina recommends for GenomeStudio. A zero threshold
+// disables its rule. Rules on the AB cluster only apply to loci with an AB
+// cluster, ClusterSeparation only to polymorphic loci and rules on genotype
+// counts only to loci with called samples.
+type FilterRules struct {
+	MinCallFreq          float32
+	MinClusterSeparation float32
+	MinGenTrainScore     float32
+	MinABRMean           float32
+	MinABRRatio          float32
+	MinABThetaMean       float32
+	MaxABThetaMean       float32
+	MaxABThetaDev        float32
+	MinHetExcess         float32
+	MaxHetExcess         float32
+	// MinMinorHomCount excludes common loci, with a minor allele frequency
+	// of at least MinMAFForMinorHom, that have fewer minor homozygotes.
+	MinMinorHomCount  int
+	MinMAFForMinorHom float32
+}
+
+// DefaultFilterRules returns the thresholds of Illumina's recommended SNP
+// filtering rules.
+func DefaultFilterRules() FilterRules {
+	return FilterRules{
+		MinCallFreq:          0.97,
+		MinClusterSeparation: 0.3,
+		MinGenTrainScore:     0.7,
+		MinABRMean:           0.2,
+		MinABRRatio:          0.3,
+		MinABThetaMean:       0.2,
+		MaxABThetaMean:       0.8,
+		MaxABThetaDev:        0.07,
+		MinHetExcess:         -0.3,
+		MaxHetExcess:         0.2,
+		MinMinorHomCount:     1,
+		MinMAFForMinorHom:    0.1,
+	}
+}
+
+// Check returns the rules q fails, or nil if it passes them all.
+func (f FilterRules) Check(q LocusQuality) []string {
+	var failed []string
+	below := func(rule string, x, min float32) {
+		if min != 0 && !isNaN(x) && x < min {
+			failed = append(failed, fmt.Sprintf("%s %.4g < %.4g", rule, x, min))
+		}
+	}
+	above := func(rule string, x, max float32) {
+		if max != 0 && !isNaN(x) && x > max {
+			failed = append(failed, fmt.Sprintf("%s %.4g > %.4g", rule, x, max))
+		}
+	}
+	below("CallFreq", q.CallFreq, f.MinCallFreq)
+	// Monomorphic loci have no cluster separation.
+	classes := 0
+	for _, n := range []int{q.NumAA, q.NumAB, q.NumBB} {
+		if n > 0 {
+			classes++
+		}
+	}
+	if classes > 1 {
+		below("ClusterSeparation", q.ClusterSeparation, f.MinClusterSeparation)
+	}
+	below("GenTrainScore", q.GenTrainScore, f.MinGenTrainScore)
+	below("ABRMean", q.ABRMean, f.MinABRMean)
+	below("ABRRatio", q.ABRRatio, f.MinABRRatio)
+	below("ABThetaMean", q.ABThetaMean, f.MinABThetaMean)
+	above("ABThetaMean", q.ABThetaMean, f.MaxABThetaMean)
+	above("ABThetaDev", q.ABThetaDev, f.MaxABThetaDev)
+	below("HetExcess", q.HetExcess, f.MinHetExcess)
+	above("HetExcess", q.HetExcess, f.MaxHetExcess)
+	if f.MinMinorHomCount > 0 && !isNaN(q.MinorAlleleFreq) && q.MinorAlleleFreq >= f.MinMAFForMinorHom && q.MinorHomCount < f.MinMinorHomCount {
+		failed = append(failed, fmt.Sprintf("MinorHomCount %d < %d", q.MinorHomCount, f.MinMinorHomCount))
+	}
+	return failed
+}
+
+// Exclusions returns the names of the loci in qs that fail any of the rules
+// in f.
+func (f FilterRules) Exclusions(qs []LocusQuality) []string {
+	var names []string
+	for _, q := range qs {
+		if len(f.Check(q)) > 0 {
+			names = append(names, q.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,86 @@
+package beadarray
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNewLocusQuality(t *testing.T) {
+	c := testClusterRecord(25, 50, 25)
+	c.Name = "rs1"
+	c.ClusterScore = ClusterScore{ClusterSeparation: 0.9, TotalScore: 0.85}
+	q := NewLocusQuality(c)
+	if q.ABRRatio != 2 || q.ABThetaDev != 0.04 || q.CallFreq != 1 || q.MinorAlleleFreq != 0.5 || q.MinorHomCount != 25 {
+		t.Errorf("NewLocusQuality() = %+v", q)
+	}
+	if math.Abs(float64(q.HetExcess)) > 1e-6 {
+		t.Errorf("HetExcess = %v, want 0 at Hardy-Weinberg equilibrium", q.HetExcess)
+	}
+	if fails := DefaultFilterRules().Check(q); fails != nil {
+		t.Errorf("Check() = %v, want pass", fails)
+	}
+
+	m := NewLocusQuality(testClusterRecord(100, 0, 0))
+	if !isNaN(m.ABRRatio) || !isNaN(m.HetExcess) || m.MinorAlleleFreq != 0 {
+		t.Errorf("monomorphic NewLocusQuality() = %+v", m)
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	rules := DefaultFilterRules()
+	tests := []struct {
+		name   string
+		modify func(c *ClusterRecord)
+		fails  int
+	}{
+		{"good", func(c *ClusterRecord) {}, 0},
+		{"low separation", func(c *ClusterRecord) { c.ClusterScore.ClusterSeparation = 0.1 }, 1},
+		{"low AB R", func(c *ClusterRecord) { c.ABClusterStats.RMean = 0.15 }, 2},
+		{"het excess", func(c *ClusterRecord) { c.ABClusterStats.N = 90; c.AAClusterStats.N = 5; c.BBClusterStats.N = 5 }, 1},
+		{"no minor homozygotes", func(c *ClusterRecord) { c.BBClusterStats.N = 0; c.ABClusterStats.N = 30; c.AAClusterStats.N = 70 }, 1},
+		{"wide AB theta", func(c *ClusterRecord) { c.ABClusterStats.ThetaDev = 0.1 }, 1},
+	}
+	var qs []LocusQuality
+	var want []string
+	for _, tt := range tests {
+		c := testClusterRecord(25, 50, 25)
+		c.Name = tt.name
+		c.ClusterScore = ClusterScore{ClusterSeparation: 0.9, TotalScore: 0.85}
+		tt.modify(&c)
+		q := NewLocusQuality(c)
+		if fails := rules.Check(q); len(fails) != tt.fails {
+			t.Errorf("%s: Check() = %v, want %d failures", tt.name, fails, tt.fails)
+		}
+		qs = append(qs, q)
+		if tt.fails > 0 {
+			want = append(want, tt.name)
+		}
+	}
+	if got := rules.Exclusions(qs); !reflect.DeepEqual(got, want) {
+		t.Errorf("Exclusions() = %v, want %v", got, want)
+	}
+}
+
+func TestClusterQualityFromSamples(t *testing.T) {
+	gtcs, _ := trainingGTCs(t, 6, 3)
+	b := testBPM(3)
+	e := testEGT(3)
+	qs, err := ClusterQualityFromSamples(e, b, gtcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// testGTCData gives SNP i genotype code i%4 in every sample.
+	for i, want := range [][4]int{{0, 0, 0, 6}, {6, 0, 0, 0}, {0, 6, 0, 0}} {
+		q := qs[i]
+		if got := [4]int{q.NumAA, q.NumAB, q.NumBB, q.NumNC}; got != want || q.Name != b.Names[i] {
+			t.Errorf("locus %d: %s counts = %v, want %v", i, q.Name, got, want)
+		}
+	}
+	if qs[0].CallFreq != 0 || qs[1].CallFreq != 1 {
+		t.Errorf("CallFreq = %v, %v", qs[0].CallFreq, qs[1].CallFreq)
+	}
+	if got := ClusterQuality(e); len(got) != 3 || got[1].NumAB != 1 {
+		t.Errorf("ClusterQuality() = %+v", got)
+	}
+}
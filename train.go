@@ -0,0 +1,289 @@
+package beadarray
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Parameters of the cluster training.
+const (
+	// trainIterations bounds the number of k-means iterations per locus.
+	trainIterations = 20
+	// lowIntensityFraction is the fraction of a locus' median R below which
+	// samples are left out of training, and the fraction of the lowest
+	// cluster R used as the IntensityThreshold.
+	lowIntensityFraction = 0.2
+	// separationDevs is the distance between adjacent clusters, in combined
+	// theta deviations, that gives a ClusterSeparation of 1.
+	separationDevs = 4
+)
+
+// Initial cluster thetas, which are also the positions recorded for
+// clusters that no sample falls into.
+var initialThetas = [3]float32{0.05, 0.5, 0.95}
+
+// TrainEGT clusters the samples in gtcs, which must all have been called
+// against b, and returns a cluster file for b with records in manifest
+// order. Loci on chromosome X are trained on female samples and loci on
+// chromosome Y on male samples, as reported by GTC.Gender, falling back to
+// all samples if there are none. Loci on chromosomes Y and MT are treated as
+// haploid and have no AB cluster.
+//
+// The cluster file has the data block version WriteEGT writes by default.
+// DateCreated and the software versions are left empty for the caller to
+// set, so that training the same samples gives the same file.
+//
+// The normalized intensities of every sample are held in memory while
+// training.
+func TrainEGT(b BPM, gtcs []GTC) (*EGT, error) {
+	if len(gtcs) == 0 {
+		return nil, fmt.Errorf("no samples to train on")
+	}
+	rs := make([][]float32, len(gtcs))
+	thetas := make([][]float32, len(gtcs))
+	var females, males []int
+	for j, g := range gtcs {
+		var err error
+		if rs[j], thetas[j], err = g.PolarIntensities(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", g.Filename(), err)
+		}
+		gender, err := g.Gender()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", g.Filename(), err)
+		}
+		switch gender {
+		case "F":
+			females = append(females, j)
+		case "M":
+			males = append(males, j)
+		}
+	}
+	all := make([]int, len(gtcs))
+	for j := range all {
+		all[j] = j
+	}
+
+	records := make([]ClusterRecord, len(b.Names))
+	locusR := make([]float32, 0, len(gtcs))
+	locusTheta := make([]float32, 0, len(gtcs))
+	for i, name := range b.Names {
+		locus, ok := b.LocusByIndex(i)
+		if !ok {
+			return nil, fmt.Errorf("no locus entry for %s", name)
+		}
+		samples := all
+		switch locus.Chrom {
+		case "X":
+			if len(females) > 0 {
+				samples = females
+			}
+		case "Y":
+			if len(males) > 0 {
+				samples = males
+			}
+		}
+		locusR, locusTheta = locusR[:0], locusTheta[:0]
+		for _, j := range samples {
+			locusR = append(locusR, rs[j][i])
+			locusTheta = append(locusTheta, thetas[j][i])
+		}
+		record := TrainClusterRecord(locusR, locusTheta, isHaploid(locus.Chrom))
+		record.Name = name
+		record.Address = locus.AddressA
+		records[i] = record
+	}
+	e := &EGT{
+		ManifestName:     b.ManifestName,
+		DataBlockVersion: egtDataBlockVersion,
+	}
+	e.SetClusterRecords(records)
+	return e, nil
+}
+
+func isHaploid(chrom string) bool {
+	return chrom == "Y" || chrom == "MT"
+}
+
+// TrainClusterRecord clusters the normalized intensities of one locus
+// across samples into AA, AB and BB clusters. Samples with NaN intensities
+// or with R below lowIntensityFraction of the median are ignored. If
+// haploid is true no AB cluster is formed. A cluster that no sample falls
+// into has N 0, the initial theta for that genotype and the mean R of the
+// other clusters.
+func TrainClusterRecord(rs, thetas []float32, haploid bool) ClusterRecord {
+	var r, theta []float32
+	for i := range rs {
+		if !isNaN(rs[i]) && !isNaN(thetas[i]) {
+			r = append(r, rs[i])
+			theta = append(theta, thetas[i])
+		}
+	}
+	if len(r) > 0 {
+		cutoff := lowIntensityFraction * median(r)
+		n := 0
+		for i := range r {
+			if r[i] >= cutoff {
+				r[n], theta[n] = r[i], theta[i]
+				n++
+			}
+		}
+		r, theta = r[:n], theta[:n]
+	}
+
+	centers := initialThetas
+	active := [3]bool{true, !haploid, true}
+	assign := make([]int, len(theta))
+	for iter := 0; iter < trainIterations; iter++ {
+		changed := iter == 0
+		for i, t := range theta {
+			best := -1
+			for k := range centers {
+				if active[k] && (best < 0 || abs32(t-centers[k]) < abs32(t-centers[best])) {
+					best = k
+				}
+			}
+			if assign[i] != best {
+				assign[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		var sum [3]float32
+		var n [3]int
+		for i, t := range theta {
+			sum[assign[i]] += t
+			n[assign[i]]++
+		}
+		for k := range centers {
+			if n[k] > 0 {
+				centers[k] = sum[k] / float32(n[k])
+			}
+		}
+	}
+
+	var stats [3]ClusterStats
+	var groupR, groupTheta [3][]float32
+	for i := range theta {
+		k := assign[i]
+		groupR[k] = append(groupR[k], r[i])
+		groupTheta[k] = append(groupTheta[k], theta[i])
+	}
+	var rSum float32
+	populated := 0
+	for k := range stats {
+		if len(groupR[k]) == 0 {
+			continue
+		}
+		stats[k].N = len(groupR[k])
+		stats[k].ThetaMean, stats[k].ThetaDev = meanDev(groupTheta[k])
+		stats[k].RMean, stats[k].RDev = meanDev(groupR[k])
+		rSum += stats[k].RMean
+		populated++
+	}
+	for k := range stats {
+		if stats[k].N == 0 {
+			stats[k].ThetaMean = initialThetas[k]
+			if populated > 0 {
+				stats[k].RMean = rSum / float32(populated)
+			}
+		}
+	}
+
+	record := ClusterRecord{
+		AAClusterStats: stats[0],
+		ABClusterStats: stats[1],
+		BBClusterStats: stats[2],
+	}
+	minR := float32(math.Inf(1))
+	for k := range stats {
+		if stats[k].N > 0 && stats[k].RMean < minR {
+			minR = stats[k].RMean
+		}
+	}
+	if populated > 0 {
+		record.IntensityThreshold = lowIntensityFraction * minR
+	}
+
+	// The total score is the fraction of samples close to their cluster,
+	// reduced for poorly separated clusters.
+	record.ClusterScore.ClusterSeparation = ClusterSeparation(record)
+	if len(theta) > 0 {
+		near := 0
+		for i, t := range theta {
+			s := stats[assign[i]]
+			if abs32(t-s.ThetaMean) <= outlierDevs*float32(math.Max(float64(s.ThetaDev), minThetaDev)) {
+				near++
+			}
+		}
+		score := float32(near) / float32(len(theta))
+		if populated > 1 {
+			score *= record.ClusterScore.ClusterSeparation
+		}
+		record.ClusterScore.TotalScore = score
+		record.ClusterScore.OriginalScore = score
+	}
+	return record
+}
+
+// ClusterSeparation scores how well the populated clusters of c are
+// separated in theta, from 0 to 1. Adjacent clusters separationDevs
+// combined theta deviations apart score 1. A record with fewer than two
+// populated clusters scores 0.
+func ClusterSeparation(c ClusterRecord) float32 {
+	var clusters []ClusterStats
+	for _, s := range []ClusterStats{c.AAClusterStats, c.ABClusterStats, c.BBClusterStats} {
+		if s.N > 0 {
+			clusters = append(clusters, s)
+		}
+	}
+	if len(clusters) < 2 {
+		return 0
+	}
+	sep := float32(1)
+	for k := 1; k < len(clusters); k++ {
+		lo, hi := clusters[k-1], clusters[k]
+		dev := float32(math.Max(float64(lo.ThetaDev), minThetaDev) + math.Max(float64(hi.ThetaDev), minThetaDev))
+		x := (hi.ThetaMean - lo.ThetaMean) / dev / separationDevs
+		if x < sep {
+			sep = x
+		}
+	}
+	if sep < 0 {
+		sep = 0
+	}
+	return sep
+}
+
+func abs32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func median(xs []float32) float32 {
+	s := append([]float32(nil), xs...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// meanDev returns the mean and population standard deviation of xs.
+func meanDev(xs []float32) (float32, float32) {
+	var sum float64
+	for _, x := range xs {
+		sum += float64(x)
+	}
+	mean := sum / float64(len(xs))
+	var ss float64
+	for _, x := range xs {
+		d := float64(x) - mean
+		ss += d * d
+	}
+	return float32(mean), float32(math.Sqrt(ss / float64(len(xs))))
+}
@@ -0,0 +1,148 @@
+package beadarray
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTrainClusterRecord(t *testing.T) {
+	var rs, thetas []float32
+	add := func(n int, r, theta float32) {
+		for i := 0; i < n; i++ {
+			d := float32(i%5-2) / 100
+			rs = append(rs, r+d)
+			thetas = append(thetas, theta+d)
+		}
+	}
+	add(20, 1.0, 0.1)
+	add(10, 1.5, 0.55)
+	add(5, 0.9, 0.85)
+	add(3, 0.01, 0.5) // below the intensity cutoff
+
+	c := TrainClusterRecord(rs, thetas, false)
+	for _, tt := range []struct {
+		name  string
+		s     ClusterStats
+		n     int
+		theta float32
+	}{
+		{"AA", c.AAClusterStats, 20, 0.1},
+		{"AB", c.ABClusterStats, 10, 0.55},
+		{"BB", c.BBClusterStats, 5, 0.85},
+	} {
+		if tt.s.N != tt.n || abs32(tt.s.ThetaMean-tt.theta) > 1e-3 {
+			t.Errorf("%s cluster = %+v, want N %d and theta %v", tt.name, tt.s, tt.n, tt.theta)
+		}
+	}
+	if c.IntensityThreshold <= 0.01 || c.IntensityThreshold >= 0.9 {
+		t.Errorf("IntensityThreshold = %v", c.IntensityThreshold)
+	}
+	if c.ClusterScore.ClusterSeparation != 1 || c.ClusterScore.TotalScore <= 0.9 {
+		t.Errorf("ClusterScore = %+v", c.ClusterScore)
+	}
+
+	h := TrainClusterRecord(rs, thetas, true)
+	if h.ABClusterStats.N != 0 || h.AAClusterStats.N+h.BBClusterStats.N != 35 {
+		t.Errorf("haploid clusters N = %d, %d, %d; want no AB", h.AAClusterStats.N, h.ABClusterStats.N, h.BBClusterStats.N)
+	}
+
+	m := TrainClusterRecord(rs[:20], thetas[:20], false)
+	if m.AAClusterStats.N != 20 || m.ABClusterStats.N != 0 || m.BBClusterStats.N != 0 {
+		t.Errorf("monomorphic clusters N = %d, %d, %d", m.AAClusterStats.N, m.ABClusterStats.N, m.BBClusterStats.N)
+	}
+	if m.ClusterScore.ClusterSeparation != 0 || m.BBClusterStats.ThetaMean != initialThetas[2] {
+		t.Errorf("monomorphic record = %+v", m)
+	}
+}
+
+// trainingGTCs returns GTCs whose normalized intensities fall in three
+// clusters, with the genotype of locus i in sample j being (i+j)%3.
+func trainingGTCs(t *testing.T, numSamples, numLoci int) ([]GTC, [][]byte) {
+	var gtcs []GTC
+	var genotypes [][]byte
+	for j := 0; j < numSamples; j++ {
+		d := testGTCData(5, numLoci)
+		d.NormalizationTransforms = []NormalizationTransform{
+			{Version: 1, ScaleX: 1, ScaleY: 1},
+			{Version: 1, ScaleX: 1, ScaleY: 1},
+		}
+		d.Gender = "MF"[j%2]
+		var want []byte
+		for i := 0; i < numLoci; i++ {
+			jitter := int16(j % 7 * 5)
+			switch (i + j) % 3 {
+			case 0:
+				d.RawX[i], d.RawY[i] = 1000+jitter, 50
+			case 1:
+				d.RawX[i], d.RawY[i] = 600, 600+jitter
+			case 2:
+				d.RawX[i], d.RawY[i] = 50, 1000+jitter
+			}
+			want = append(want, genotypeAA+byte((i+j)%3))
+		}
+		gtcs = append(gtcs, testGTC(t, d))
+		genotypes = append(genotypes, want)
+	}
+	return gtcs, genotypes
+}
+
+func TestTrainEGT(t *testing.T) {
+	gtcs, want := trainingGTCs(t, 30, 12)
+	b := testBPM(12)
+	e, err := TrainEGT(b, gtcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Name2ClusterRecord) != 12 || e.ManifestName != b.ManifestName {
+		t.Fatalf("TrainEGT() = %d records for %q", len(e.Name2ClusterRecord), e.ManifestName)
+	}
+	if e.DataBlockVersion != egtDataBlockVersion || e.DateCreated != "" {
+		t.Errorf("TrainEGT() data block version %d, created %q", e.DataBlockVersion, e.DateCreated)
+	}
+	// Training is reproducible.
+	again, err := TrainEGT(b, gtcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf1, buf2 bytes.Buffer
+	if err := WriteEGT(&buf1, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEGT(&buf2, again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Errorf("training the same samples twice gave different cluster files")
+	}
+	for j, g := range gtcs {
+		got, _, err := g.CallGenotypes(b, e, DefaultGenCallThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			if got[i] != want[j][i] {
+				t.Errorf("sample %d, locus %d: called %s, want %s", j, i, Code2Genotype[got[i]], Code2Genotype[want[j][i]])
+			}
+		}
+	}
+}
+
+func TestTrainEGTSexChromosomes(t *testing.T) {
+	gtcs, _ := trainingGTCs(t, 30, 12)
+	b := testBPM(12)
+	b.Loci[0].Chrom = "X"
+	b.Loci[1].Chrom = "Y"
+	b.SetLoci(b.Loci)
+	e, err := TrainEGT(b, gtcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := e.Name2ClusterRecord[b.Names[0]]
+	if n := x.AAClusterStats.N + x.ABClusterStats.N + x.BBClusterStats.N; n != 15 {
+		t.Errorf("chrX trained on %d samples, want 15 females", n)
+	}
+	y := e.Name2ClusterRecord[b.Names[1]]
+	if n := y.AAClusterStats.N + y.ABClusterStats.N + y.BBClusterStats.N; n != 15 || y.ABClusterStats.N != 0 {
+		t.Errorf("chrY clusters N = %d, %d, %d; want 15 males and no AB", y.AAClusterStats.N, y.ABClusterStats.N, y.BBClusterStats.N)
+	}
+}